@@ -0,0 +1,131 @@
+package wredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// CredentialsProvider returns the username and password used to AUTH a new
+// connection. An empty username will use the Redis "default" user.
+type CredentialsProvider func(context.Context) (username, password string, err error)
+
+// Username sets the ACL username in the Config. Connections are AUTH'd using
+// both the Username and Password.
+//
+// See: https://redis.io/commands/auth
+func Username(user string) Option {
+	return func(cfg Config) (Config, error) {
+		if empty(user) {
+			return cfg, errors.New("wredis: empty username")
+		}
+		cfg.Username = user
+		return cfg, nil
+	}
+}
+
+// Credentials sets a CredentialsProvider in the Config, which is used in place
+// of the Username and Password. The provider is called for every new
+// connection; and if refresh is > 0, idle connections are re-AUTH'd with fresh
+// credentials when borrowed, once refresh has elapsed since they were last
+// AUTH'd. This allows short-lived tokens to be used as passwords.
+//
+// A connection is only re-AUTH'd when it's borrowed from the pool, so one which
+// is held for longer than refresh (e.g. by a long running Int, or a blocking
+// command) isn't re-AUTH'd until it's next borrowed. Tokens should outlive
+// refresh by at least as long as connections are held. The multiplexed
+// connections of AutoPipeline are re-AUTH'd ahead of their next batch, and
+// Subscriptions are reconnected.
+func Credentials(provider CredentialsProvider, refresh time.Duration) Option {
+	return func(cfg Config) (Config, error) {
+		if provider == nil {
+			return cfg, errors.New("wredis: nil credentials provider")
+		}
+		cfg.CredentialsProvider = provider
+		cfg.CredentialsRefresh = refresh
+		return cfg, nil
+	}
+}
+
+// credentials returns the username & password to AUTH with
+func (c Config) credentials() (string, string, error) {
+	if c.CredentialsProvider == nil {
+		return c.Username, c.Password, nil
+	}
+	return c.CredentialsProvider(context.Background())
+}
+
+// auth AUTHs the connection, if any credentials are configured.
+func (c Config) auth(conn redis.Conn) error {
+	user, pass, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	return authWith(conn, user, pass)
+}
+
+// authWith AUTHs the connection with the username & password, if provided.
+func authWith(conn redis.Conn, user, pass string) error {
+	args := authArgs(user, pass)
+	if args == nil {
+		return nil
+	}
+	_, err := conn.Do("AUTH", args...)
+	return err
+}
+
+// authArgs returns the arguments of AUTH, or nil if there's no password
+func authArgs(user, pass string) redis.Args {
+	if pass == "" {
+		return nil
+	}
+
+	args := redis.Args{}
+	if user != "" {
+		args = args.Add(user)
+	}
+	return args.Add(pass)
+}
+
+// reauthenticates reports if connections need to be periodically re-AUTH'd
+func (c Config) reauthenticates() bool {
+	return c.CredentialsProvider != nil && c.CredentialsRefresh > 0
+}
+
+// testOnBorrow returns the configured borrowFunc, wrapped to re-AUTH idle
+// connections whose credentials are due to be refreshed.
+func (c Config) testOnBorrow() borrowFunc {
+	borrow := c.TestOnBorrower(c)
+	if !c.reauthenticates() {
+		return borrow
+	}
+	return func(conn redis.Conn, t time.Time) error {
+		if ac, ok := conn.(*authConn); ok && time.Since(ac.authed) >= c.CredentialsRefresh {
+			if err := c.auth(ac.Conn); err != nil {
+				return err
+			}
+			ac.authed = time.Now()
+		}
+		return borrow(conn, t)
+	}
+}
+
+// authConn records when a redis.Conn was last AUTH'd
+type authConn struct {
+	redis.Conn
+	authed time.Time
+}
+
+var _ redis.ConnWithTimeout = &authConn{}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *authConn) DoWithTimeout(d time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, d, cmd, args...)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *authConn) ReceiveWithTimeout(d time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, d)
+}
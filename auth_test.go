@@ -0,0 +1,203 @@
+package wredis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auth", func() {
+	var server *fakeServer
+
+	// returns all the AUTH commands the server received
+	auths := func() []string {
+		var cmds []string
+		for _, cmd := range server.Commands() {
+			if cmd[0] == "AUTH" {
+				cmds = append(cmds, strings.Join(cmd, " "))
+			}
+		}
+		return cmds
+	}
+
+	BeforeEach(func() {
+		var err error
+		server, err = newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Ω(server.Close()).Should(Succeed())
+	})
+
+	It("should not AUTH without a password", func() {
+		w, err := Safe(Host("127.0.0.1"), Port(server.Port()))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+		Ω(auths()).Should(BeEmpty())
+	})
+
+	It("should AUTH with the password", func() {
+		w, err := Safe(Host("127.0.0.1"), Port(server.Port()), Password("secret"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+		Ω(auths()).Should(Equal([]string{"AUTH secret"}))
+	})
+
+	It("should AUTH with the username and password", func() {
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			Username("app"),
+			Password("secret"),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+		Ω(auths()).Should(Equal([]string{"AUTH app secret"}))
+	})
+
+	It("should fail given an empty username", func() {
+		_, err := Safe(Username(" "))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty username"))
+	})
+
+	It("should fail to connect when AUTH fails", func() {
+		server.Handle("AUTH", func([]string) string {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		})
+		w, err := Safe(Host("127.0.0.1"), Port(server.Port()), Password("nope"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		_, err = w.Ping()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("WRONGPASS"))
+	})
+
+	Context("Credentials", func() {
+		var calls int32
+
+		provider := func(ctx context.Context) (string, string, error) {
+			n := atomic.AddInt32(&calls, 1)
+			return "app", fmt.Sprintf("token-%d", n), nil
+		}
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&calls, 0)
+		})
+
+		It("should fail given a nil provider", func() {
+			_, err := Safe(Credentials(nil, 0))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: nil credentials provider"))
+		})
+
+		It("should fetch credentials for every new connection", func() {
+			w, err := Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				MaxIdle(0),
+				Credentials(provider, 0),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1", "AUTH app token-2"}))
+		})
+
+		It("should re-AUTH idle connections once the refresh has elapsed", func() {
+			w, err := Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				MaxIdle(1),
+				Credentials(provider, 50*time.Millisecond),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1"}))
+
+			time.Sleep(60 * time.Millisecond)
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1", "AUTH app token-2"}))
+		})
+
+		It("should re-AUTH auto pipelined connections once the refresh has elapsed", func() {
+			w, err := Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				AutoPipeline(1, 0, 16),
+				Credentials(provider, 50*time.Millisecond),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1"}))
+
+			time.Sleep(60 * time.Millisecond)
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1", "AUTH app token-2"}))
+		})
+
+		It("should redial an auto pipelined connection whose re-AUTH fails", func() {
+			server.Handle("AUTH", func(args []string) string {
+				if args[2] == "token-2" {
+					return "-WRONGPASS invalid username-password pair\r\n"
+				}
+				return "+OK\r\n"
+			})
+			w, err := Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				AutoPipeline(1, 0, 16),
+				Credentials(provider, 50*time.Millisecond),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			time.Sleep(60 * time.Millisecond)
+			_, err = w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(auths()).Should(Equal([]string{"AUTH app token-1", "AUTH app token-2", "AUTH app token-3"}))
+		})
+
+		It("should fail to connect when the provider fails", func() {
+			w, err := Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				Credentials(func(context.Context) (string, string, error) {
+					return "", "", errors.New("no token")
+				}, 0),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			_, err = w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("no token"))
+		})
+	})
+})
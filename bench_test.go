@@ -0,0 +1,117 @@
+package wredis_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/crowdriff/wredis"
+)
+
+// benchmarks compare the native RESP reader/writer with redigo's, run with:
+//
+//	go test -run XXX -bench . -benchmem
+
+const benchKey = "wredis::bench"
+
+var benchKeys = []string{"wredis::bench::0", "wredis::bench::1", "wredis::bench::2", "wredis::bench::3"}
+
+// benchWredis returns a Wredis for the benchmark, with the bench keys set
+func benchWredis(b *testing.B, opts ...Option) Wredis {
+	w, err := Unsafe(opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		w.Del(append(benchKeys, benchKey)...)
+		w.Close()
+	})
+
+	if err = w.Set(benchKey, "benchmark value"); err != nil {
+		b.Fatal(err)
+	}
+	for i, key := range benchKeys {
+		if err = w.Set(key, strconv.Itoa(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return w
+}
+
+func benchGet(b *testing.B, opts ...Option) {
+	w := benchWredis(b, opts...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.Get(benchKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchGetBytes(b *testing.B, opts ...Option) {
+	w := benchWredis(b, opts...)
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = w.GetBytes(benchKey, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchMGet(b *testing.B, opts ...Option) {
+	w := benchWredis(b, opts...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.MGet(benchKeys...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchMGetInto(b *testing.B, opts ...Option) {
+	w := benchWredis(b, opts...)
+	ss := make([]string, 0, len(benchKeys))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if ss, err = w.MGetInto(ss, benchKeys...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B)            { benchGet(b) }
+func BenchmarkGetRedigo(b *testing.B)      { benchGet(b, RedigoDialer()) }
+func BenchmarkGetBytes(b *testing.B)       { benchGetBytes(b) }
+func BenchmarkGetBytesRedigo(b *testing.B) { benchGetBytes(b, RedigoDialer()) }
+func BenchmarkMGet(b *testing.B)           { benchMGet(b) }
+func BenchmarkMGetRedigo(b *testing.B)     { benchMGet(b, RedigoDialer()) }
+func BenchmarkMGetInto(b *testing.B)       { benchMGetInto(b) }
+func BenchmarkMGetIntoRedigo(b *testing.B) { benchMGetInto(b, RedigoDialer()) }
+func BenchmarkGetRESP3(b *testing.B)       { benchGet(b, Protocol(3)) }
+func BenchmarkMGetIntoRESP3(b *testing.B)  { benchMGetInto(b, Protocol(3)) }
+
+func benchGetParallel(b *testing.B, opts ...Option) {
+	w := benchWredis(b, opts...)
+	b.ReportAllocs()
+	b.SetParallelism(100)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := w.Get(benchKey); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) { benchGetParallel(b, Wait(true)) }
+func BenchmarkGetParallelAutoPipeline(b *testing.B) {
+	benchGetParallel(b, AutoPipeline(2, 0, 128))
+}
@@ -0,0 +1,289 @@
+package wredis
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// SetBit sets or clears the bit at the offset of the string value of the key,
+// returning the bit's original value.
+//
+// See: https://redis.io/commands/setbit
+func (w *impl) SetBit(key string, offset int64, value bool) (bool, error) {
+	if empty(key) {
+		return boolErr("wredis: empty key")
+	}
+	if offset < 0 {
+		return boolErr("wredis: invalid offset")
+	}
+	bit := 0
+	if value {
+		bit = 1
+	}
+	return w.Bool(func(conn redis.Conn) (bool, error) {
+		return redis.Bool(conn.Do("SETBIT", key, offset, bit))
+	})
+}
+
+// GetBit returns the bit at the offset of the string value of the key.
+//
+// See: https://redis.io/commands/getbit
+func (w *impl) GetBit(key string, offset int64) (bool, error) {
+	if empty(key) {
+		return boolErr("wredis: empty key")
+	}
+	if offset < 0 {
+		return boolErr("wredis: invalid offset")
+	}
+	return w.Bool(func(conn redis.Conn) (bool, error) {
+		return redis.Bool(conn.Do("GETBIT", key, offset))
+	})
+}
+
+// BitRange is a range of a string value, from Start to End inclusive; where
+// negative values count back from the end of the string. They're in bytes,
+// unless Bit is set (which requires Redis 7).
+type BitRange struct {
+	Start int64
+	End   int64
+	Bit   bool
+}
+
+// args returns the range's arguments, or none for a nil range
+func (r *BitRange) args() redis.Args {
+	if r == nil {
+		return nil
+	}
+	args := redis.Args{}.Add(r.Start, r.End)
+	if r.Bit {
+		args = args.Add("BIT")
+	}
+	return args
+}
+
+// BitCount returns the number of bits set in the string value of the key,
+// within the range if it's not nil.
+//
+// See: https://redis.io/commands/bitcount
+func (w *impl) BitCount(key string, r *BitRange) (int64, error) {
+	if empty(key) {
+		return int64Err("wredis: empty key")
+	}
+	args := redis.Args{}.Add(key).Add(r.args()...)
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("BITCOUNT", args...))
+	})
+}
+
+// BitPos returns the position of the first bit set to the value in the string
+// value of the key, within the range if it's not nil; or -1 if there isn't
+// one.
+//
+// See: https://redis.io/commands/bitpos
+func (w *impl) BitPos(key string, value bool, r *BitRange) (int64, error) {
+	if empty(key) {
+		return int64Err("wredis: empty key")
+	}
+	bit := 0
+	if value {
+		bit = 1
+	}
+	args := redis.Args{}.Add(key, bit).Add(r.args()...)
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("BITPOS", args...))
+	})
+}
+
+// BitOperation is a bitwise operation of BitOp
+type BitOperation string
+
+// The operations of BitOp
+const (
+	BitAnd BitOperation = "AND"
+	BitOr  BitOperation = "OR"
+	BitXor BitOperation = "XOR"
+	BitNot BitOperation = "NOT"
+)
+
+// BitOp performs the bitwise operation between the keys, storing the result in
+// dst and returning its length. BitNot takes a single key.
+//
+// See: https://redis.io/commands/bitop
+func (w *impl) BitOp(op BitOperation, dst string, keys ...string) (int64, error) {
+	switch op {
+	case BitAnd, BitOr, BitXor:
+	case BitNot:
+		if len(keys) > 1 {
+			return int64Err("wredis: not takes one key")
+		}
+	default:
+		return int64Err("wredis: invalid bit operation")
+	}
+	if empty(dst) {
+		return int64Err("wredis: empty dst")
+	}
+	if len(keys) == 0 {
+		return int64Err("wredis: no keys")
+	}
+	if any(keys, empty) {
+		return int64Err("wredis: empty keys")
+	}
+	args := redis.Args{}.Add(string(op), dst).AddFlat(keys)
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("BITOP", args...))
+	})
+}
+
+// BitEncoding is the encoding of an integer field of a BitField, e.g. "u8" or
+// "i16".
+type BitEncoding struct {
+	Signed bool
+	Bits   uint
+}
+
+// Signed returns the encoding of a signed integer of up to 64 bits
+func Signed(bits uint) BitEncoding {
+	return BitEncoding{Signed: true, Bits: bits}
+}
+
+// Unsigned returns the encoding of an unsigned integer of up to 63 bits
+func Unsigned(bits uint) BitEncoding {
+	return BitEncoding{Bits: bits}
+}
+
+func (e BitEncoding) String() string {
+	if e.Signed {
+		return "i" + strconv.FormatUint(uint64(e.Bits), 10)
+	}
+	return "u" + strconv.FormatUint(uint64(e.Bits), 10)
+}
+
+// valid returns if Redis supports the encoding
+func (e BitEncoding) valid() bool {
+	if e.Signed {
+		return e.Bits > 0 && e.Bits <= 64
+	}
+	return e.Bits > 0 && e.Bits <= 63
+}
+
+// BitOverflow is the behaviour of a BitField's SET and INCRBY operations when
+// they overflow (or underflow) the field's encoding.
+type BitOverflow string
+
+// The overflow behaviours of a BitField
+const (
+	OverflowWrap BitOverflow = "WRAP" // wrap around, the default
+	OverflowSat  BitOverflow = "SAT"  // saturate at the minimum or maximum
+	OverflowFail BitOverflow = "FAIL" // do nothing, and reply nil
+)
+
+// BitField builds a BITFIELD command, of GET, SET and INCRBY operations on the
+// integer fields of the string value of a key; which are run by Exec. Offsets
+// are in bits.
+//
+// See: https://redis.io/commands/bitfield
+type BitField struct {
+	w      *impl
+	key    string
+	args   redis.Args
+	ops    int
+	writes bool // whether any operation is a SET, INCRBY or OVERFLOW
+	err    error
+}
+
+// BitField returns a BitField builder for the key
+func (w *impl) BitField(key string) *BitField {
+	return &BitField{w: w, key: key, args: redis.Args{}.Add(key)}
+}
+
+// op adds an operation on the field, or records the encoding's error
+func (b *BitField) op(name string, enc BitEncoding, offset int64, values ...interface{}) *BitField {
+	if b.err != nil {
+		return b
+	}
+	if !enc.valid() {
+		b.err = errors.New("wredis: invalid bit encoding")
+		return b
+	}
+	if offset < 0 {
+		b.err = errors.New("wredis: invalid offset")
+		return b
+	}
+	b.args = b.args.Add(name, enc.String(), offset).Add(values...)
+	b.ops++
+	b.writes = b.writes || name != "GET"
+	return b
+}
+
+// Get gets the field at the offset
+func (b *BitField) Get(enc BitEncoding, offset int64) *BitField {
+	return b.op("GET", enc, offset)
+}
+
+// Set sets the field at the offset to the value, replying its old value
+func (b *BitField) Set(enc BitEncoding, offset int64, value int64) *BitField {
+	return b.op("SET", enc, offset, value)
+}
+
+// IncrBy increments the field at the offset, replying its new value
+func (b *BitField) IncrBy(enc BitEncoding, offset int64, increment int64) *BitField {
+	return b.op("INCRBY", enc, offset, increment)
+}
+
+// Overflow sets the overflow behaviour of the SET and INCRBY operations which
+// follow it.
+func (b *BitField) Overflow(overflow BitOverflow) *BitField {
+	if b.err != nil {
+		return b
+	}
+	switch overflow {
+	case OverflowWrap, OverflowSat, OverflowFail:
+		b.args = b.args.Add("OVERFLOW", string(overflow))
+		b.writes = true
+	default:
+		b.err = errors.New("wredis: invalid overflow")
+	}
+	return b
+}
+
+// Exec runs the operations, returning their replies in order; where the reply
+// of an operation which failed with OverflowFail is nil. When every operation
+// is a GET they're run with BITFIELD_RO, so are allowed when ReadOnly.
+func (b *BitField) Exec() ([]*int64, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if empty(b.key) {
+		return nil, errors.New("wredis: empty key")
+	}
+	if b.ops == 0 {
+		return nil, errors.New("wredis: no bitfield operations")
+	}
+
+	cmd := "BITFIELD_RO"
+	if b.writes {
+		cmd = "BITFIELD"
+	}
+	var results []*int64
+	err := b.w.with(func(conn redis.Conn) error {
+		replies, err := redis.Values(conn.Do(cmd, b.args...))
+		if err != nil {
+			return err
+		}
+		results = make([]*int64, len(replies))
+		for i, reply := range replies {
+			if reply == nil {
+				continue
+			}
+			n, err := redis.Int64(reply, nil)
+			if err != nil {
+				return err
+			}
+			results[i] = &n
+		}
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,182 @@
+package wredis_test
+
+import (
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bitmaps", func() {
+	testKey := "wredis::test::bitmap"
+	otherKey := "wredis::test::bitmap2"
+	dstKey := "wredis::test::bitmap::dst"
+
+	BeforeEach(func() {
+		unsafe.Del(testKey, otherKey, dstKey)
+	})
+
+	Context("SetBit & GetBit", func() {
+		It("should fail given an invalid key or offset", func() {
+			_, err := safe.SetBit("", 0, true)
+			Ω(err).Should(MatchError("wredis: empty key"))
+			_, err = safe.GetBit(testKey, -1)
+			Ω(err).Should(MatchError("wredis: invalid offset"))
+		})
+
+		It("should set and get bits", func() {
+			Ω(safe.SetBit(testKey, 7, true)).Should(BeFalse())
+			Ω(safe.SetBit(testKey, 7, true)).Should(BeTrue())
+			Ω(safe.GetBit(testKey, 7)).Should(BeTrue())
+			Ω(safe.GetBit(testKey, 6)).Should(BeFalse())
+			Ω(safe.Get(testKey)).Should(Equal("\x01"))
+
+			Ω(safe.SetBit(testKey, 7, false)).Should(BeTrue())
+			Ω(safe.GetBit(testKey, 7)).Should(BeFalse())
+		})
+	})
+
+	Context("BitCount & BitPos", func() {
+		BeforeEach(func() {
+			Ω(safe.Set(testKey, "\x00\xff\xf0")).Should(Succeed())
+		})
+
+		It("should count the bits set", func() {
+			Ω(safe.BitCount(testKey, nil)).Should(BeEquivalentTo(12))
+			Ω(safe.BitCount(testKey, &BitRange{Start: 1, End: 1})).Should(BeEquivalentTo(8))
+			Ω(safe.BitCount(testKey, &BitRange{Start: -1, End: -1})).Should(BeEquivalentTo(4))
+			Ω(safe.BitCount(otherKey, nil)).Should(BeZero())
+		})
+
+		It("should return the position of the first bit", func() {
+			Ω(safe.BitPos(testKey, true, nil)).Should(BeEquivalentTo(8))
+			Ω(safe.BitPos(testKey, false, &BitRange{Start: 1, End: 2})).Should(BeEquivalentTo(20))
+			Ω(safe.BitPos(otherKey, true, nil)).Should(BeEquivalentTo(-1))
+		})
+
+		It("should send ranges in bits", func() {
+			server, err := newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer server.Close()
+			server.Handle("BITCOUNT", func([]string) string { return ":3\r\n" })
+			w, err := Safe(Host("127.0.0.1"), Port(server.Port()))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.BitCount("k", &BitRange{Start: 5, End: 30, Bit: true})).Should(BeEquivalentTo(3))
+			Ω(server.Commands()).Should(ContainElement([]string{"BITCOUNT", "k", "5", "30", "BIT"}))
+		})
+	})
+
+	Context("BitOp", func() {
+		BeforeEach(func() {
+			Ω(safe.Set(testKey, "\x0f")).Should(Succeed())
+			Ω(safe.Set(otherKey, "\xff")).Should(Succeed())
+		})
+
+		It("should fail given an invalid operation or keys", func() {
+			_, err := safe.BitOp("NAND", dstKey, testKey)
+			Ω(err).Should(MatchError("wredis: invalid bit operation"))
+			_, err = safe.BitOp(BitNot, dstKey, testKey, otherKey)
+			Ω(err).Should(MatchError("wredis: not takes one key"))
+			_, err = safe.BitOp(BitAnd, "", testKey)
+			Ω(err).Should(MatchError("wredis: empty dst"))
+			_, err = safe.BitOp(BitAnd, dstKey)
+			Ω(err).Should(MatchError("wredis: no keys"))
+		})
+
+		It("should store the result of the operation", func() {
+			Ω(safe.BitOp(BitAnd, dstKey, testKey, otherKey)).Should(BeEquivalentTo(1))
+			Ω(safe.Get(dstKey)).Should(Equal("\x0f"))
+			Ω(safe.BitOp(BitXor, dstKey, testKey, otherKey)).Should(BeEquivalentTo(1))
+			Ω(safe.Get(dstKey)).Should(Equal("\xf0"))
+			Ω(safe.BitOp(BitOr, dstKey, testKey, otherKey)).Should(BeEquivalentTo(1))
+			Ω(safe.Get(dstKey)).Should(Equal("\xff"))
+			Ω(safe.BitOp(BitNot, dstKey, testKey)).Should(BeEquivalentTo(1))
+			Ω(safe.Get(dstKey)).Should(Equal("\xf0"))
+		})
+	})
+
+	// the miniredis test server doesn't implement BITFIELD, so it's faked
+	Context("BitField", func() {
+		var (
+			server *fakeServer
+			w      Wredis
+		)
+
+		BeforeEach(func() {
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("BITFIELD", func([]string) string {
+				return "*3\r\n:0\r\n:255\r\n$-1\r\n"
+			})
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			w.Close()
+			server.Close()
+		})
+
+		It("should fail given invalid operations", func() {
+			_, err := w.BitField(testKey).Exec()
+			Ω(err).Should(MatchError("wredis: no bitfield operations"))
+			_, err = w.BitField("").Get(Unsigned(8), 0).Exec()
+			Ω(err).Should(MatchError("wredis: empty key"))
+			_, err = w.BitField(testKey).Get(Unsigned(64), 0).Exec()
+			Ω(err).Should(MatchError("wredis: invalid bit encoding"))
+			_, err = w.BitField(testKey).Get(Signed(0), 0).Exec()
+			Ω(err).Should(MatchError("wredis: invalid bit encoding"))
+			_, err = w.BitField(testKey).Get(Signed(8), -1).Exec()
+			Ω(err).Should(MatchError("wredis: invalid offset"))
+			_, err = w.BitField(testKey).Overflow("CLAMP").Get(Signed(8), 0).Exec()
+			Ω(err).Should(MatchError("wredis: invalid overflow"))
+			Ω(server.Commands()).ShouldNot(ContainElement(ContainElement("BITFIELD")))
+		})
+
+		It("should run the operations", func() {
+			results, err := w.BitField(testKey).
+				Set(Unsigned(8), 0, 255).
+				Overflow(OverflowSat).IncrBy(Unsigned(8), 0, 10).
+				Overflow(OverflowFail).IncrBy(Signed(16), 8, 40000).
+				Exec()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Commands()).Should(ContainElement([]string{
+				"BITFIELD", testKey,
+				"SET", "u8", "0", "255",
+				"OVERFLOW", "SAT", "INCRBY", "u8", "0", "10",
+				"OVERFLOW", "FAIL", "INCRBY", "i16", "8", "40000",
+			}))
+
+			Ω(results).Should(HaveLen(3))
+			Ω(*results[0]).Should(BeEquivalentTo(0))
+			Ω(*results[1]).Should(BeEquivalentTo(255))
+			Ω(results[2]).Should(BeNil())
+		})
+
+		It("should only get the fields with BITFIELD_RO, when ReadOnly", func() {
+			server.Handle("BITFIELD_RO", func([]string) string {
+				return "*2\r\n:1\r\n:-1\r\n"
+			})
+			r, err := Safe(Host("127.0.0.1"), Port(server.Port()), ReadOnly(true))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+
+			results, err := r.BitField(testKey).Get(Unsigned(8), 0).Get(Signed(4), 8).Exec()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Commands()).Should(ContainElement([]string{
+				"BITFIELD_RO", testKey, "GET", "u8", "0", "GET", "i4", "8",
+			}))
+			Ω(*results[0]).Should(BeEquivalentTo(1))
+			Ω(*results[1]).Should(BeEquivalentTo(-1))
+
+			_, err = r.BitField(testKey).Get(Unsigned(8), 0).Set(Unsigned(8), 0, 1).Exec()
+			Ω(err).Should(MatchError(ErrReadOnly))
+			_, err = r.BitField(testKey).Overflow(OverflowSat).Get(Unsigned(8), 0).Exec()
+			Ω(err).Should(MatchError(ErrReadOnly))
+			Ω(server.Commands()).ShouldNot(ContainElement(ContainElement("BITFIELD")))
+		})
+	})
+})
@@ -0,0 +1,265 @@
+package wredis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrCircuitOpen is returned, without connecting, while the circuit breaker is
+// open.
+var ErrCircuitOpen = errors.New("wredis: circuit open")
+
+// BreakerPolicy configures the circuit breaker, which trips open after too
+// many connection failures (errors dialing, or broken connections; but not
+// error replies). While open every command fails fast with ErrCircuitOpen;
+// after the Cooldown it half-opens, and probes the server with a PING. If the
+// probe succeeds the breaker closes, otherwise it opens for another Cooldown.
+type BreakerPolicy struct {
+	// Failures is the number of consecutive connection failures which trip
+	// the breaker, 0 disables the check
+	Failures int
+	// ErrorRate is the rate (0-1) of connection failures, over the Window,
+	// which trips the breaker; 0 disables the check
+	ErrorRate float64
+	// MinRequests is the number of requests needed in the Window before the
+	// ErrorRate is checked, by default 10
+	MinRequests int
+	// Window is the period the ErrorRate is measured over, by default 10s
+	Window time.Duration
+	// Cooldown is how long the breaker stays open before probing the server
+	Cooldown time.Duration
+}
+
+// BreakerState is the state of the circuit breaker
+type BreakerState int
+
+// circuit breaker states
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreaker sets the BreakerPolicy in the Config.
+func CircuitBreaker(policy BreakerPolicy) Option {
+	return func(cfg Config) (Config, error) {
+		if policy.Failures < 0 || policy.ErrorRate < 0 || policy.ErrorRate > 1 ||
+			(policy.Failures == 0 && policy.ErrorRate == 0) {
+			return cfg, errors.New("wredis: invalid circuit breaker")
+		}
+		if policy.Cooldown <= 0 {
+			return cfg, errors.New("wredis: invalid circuit breaker cooldown")
+		}
+		if policy.MinRequests <= 0 {
+			policy.MinRequests = 10
+		}
+		if policy.Window <= 0 {
+			policy.Window = 10 * time.Second
+		}
+		cfg.BreakerPolicy = policy
+		return cfg, nil
+	}
+}
+
+// enabled returns true if the circuit breaker is enabled
+func (p BreakerPolicy) enabled() bool {
+	return p.Failures > 0 || p.ErrorRate > 0
+}
+
+// breaker is the circuit breaker for a pool
+type breaker struct {
+	policy BreakerPolicy
+	probe  func() error
+
+	mu          sync.Mutex
+	state       BreakerState
+	opened      time.Time // when the breaker last opened
+	consecutive int       // consecutive failures
+	window      time.Time // when the error rate window started
+	requests    int       // requests in the window
+	failures    int       // failures in the window
+}
+
+func newBreaker(policy BreakerPolicy, probe func() error) *breaker {
+	return &breaker{
+		policy: policy,
+		probe:  probe,
+		window: time.Now(),
+	}
+}
+
+// State returns the current state of the breaker
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns ErrCircuitOpen unless the breaker is closed. Once the cooldown
+// has elapsed, the first caller half-opens the breaker and starts the probe.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if time.Since(b.opened) >= b.policy.Cooldown {
+			b.state = BreakerHalfOpen
+			go b.halfOpen()
+		}
+	}
+	return ErrCircuitOpen
+}
+
+// halfOpen probes the server, closing the breaker if it responds
+func (b *breaker) halfOpen() {
+	err := b.probe()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.open()
+		return
+	}
+	b.state = BreakerClosed
+	b.consecutive = 0
+	b.reset(time.Now())
+}
+
+// record records the outcome of a request, tripping the breaker if needed
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.window) >= b.policy.Window {
+		b.reset(now)
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.consecutive++
+	b.failures++
+
+	if b.policy.Failures > 0 && b.consecutive >= b.policy.Failures {
+		b.open()
+		return
+	}
+	if b.policy.ErrorRate > 0 && b.requests >= b.policy.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.policy.ErrorRate {
+		b.open()
+	}
+}
+
+// open opens the breaker, the lock must be held
+func (b *breaker) open() {
+	b.state = BreakerOpen
+	b.opened = time.Now()
+}
+
+// reset starts a new error rate window, the lock must be held
+func (b *breaker) reset(now time.Time) {
+	b.window = now
+	b.requests = 0
+	b.failures = 0
+}
+
+// breakerConn records whether the connection failed with the breaker, when
+// it's closed.
+type breakerConn struct {
+	redis.Conn
+	b      *breaker
+	failed bool
+}
+
+var _ redis.ConnWithTimeout = &breakerConn{}
+
+// check records if the error is a connection failure
+func (c *breakerConn) check(err error) error {
+	if err != nil && connectionError(err) {
+		c.failed = true
+	}
+	return err
+}
+
+// Close implements redis.Conn
+func (c *breakerConn) Close() error {
+	c.check(c.Conn.Err())
+	c.b.record(c.failed)
+	return c.Conn.Close()
+}
+
+// Do implements redis.Conn
+func (c *breakerConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	return reply, c.check(err)
+}
+
+// call implements caller
+func (c *breakerConn) call(cmd string, call *respCall) error {
+	return c.check(doCall(c.Conn, cmd, call))
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *breakerConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	return reply, c.check(err)
+}
+
+// Flush implements redis.Conn
+func (c *breakerConn) Flush() error {
+	return c.check(c.Conn.Flush())
+}
+
+// Receive implements redis.Conn
+func (c *breakerConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	return reply, c.check(err)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *breakerConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	return reply, c.check(err)
+}
+
+// errorConn is a redis.Conn which failed before it could be used
+type errorConn struct{ err error }
+
+var _ redis.ConnWithTimeout = errorConn{}
+
+func (c errorConn) Close() error                                   { return nil }
+func (c errorConn) Err() error                                     { return c.err }
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, c.err }
+func (c errorConn) Send(string, ...interface{}) error              { return c.err }
+func (c errorConn) Flush() error                                   { return c.err }
+func (c errorConn) Receive() (interface{}, error)                  { return nil, c.err }
+
+func (c errorConn) DoWithTimeout(time.Duration, string, ...interface{}) (interface{}, error) {
+	return nil, c.err
+}
+
+func (c errorConn) ReceiveWithTimeout(time.Duration) (interface{}, error) {
+	return nil, c.err
+}
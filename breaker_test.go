@@ -0,0 +1,139 @@
+package wredis_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	It("should fail given an invalid policy", func() {
+		_, err := Safe(CircuitBreaker(BreakerPolicy{Cooldown: time.Second}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid circuit breaker"))
+
+		_, err = Safe(CircuitBreaker(BreakerPolicy{ErrorRate: 2, Cooldown: time.Second}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid circuit breaker"))
+
+		_, err = Safe(CircuitBreaker(BreakerPolicy{Failures: 1}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid circuit breaker cooldown"))
+	})
+
+	It("should report a closed breaker when disabled", func() {
+		Ω(safe.Stats().Breaker).Should(Equal(BreakerClosed))
+	})
+
+	Context("Redis", func() {
+		var (
+			w     Wredis
+			down  int32
+			dials int32
+		)
+
+		// dial fails while Redis is "down"
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			if atomic.LoadInt32(&down) == 1 {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+
+		newWredis := func(policy BreakerPolicy) {
+			var err error
+			w, err = Safe(CircuitBreaker(policy), NetDialer(dial), MaxIdle(0))
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&down, 1)
+			atomic.StoreInt32(&dials, 0)
+		})
+
+		AfterEach(func() {
+			Ω(w.Close()).Should(Succeed())
+		})
+
+		It("should open after consecutive failures, and close once probed", func() {
+			newWredis(BreakerPolicy{Failures: 3, Cooldown: 50 * time.Millisecond})
+
+			for i := 0; i < 3; i++ {
+				_, err := w.Ping()
+				Ω(err).Should(HaveOccurred())
+				Ω(errors.Is(err, ErrCircuitOpen)).Should(BeFalse())
+			}
+			Ω(w.Stats().Breaker).Should(Equal(BreakerOpen))
+
+			// fail fast, without dialing
+			_, err := w.Ping()
+			Ω(errors.Is(err, ErrCircuitOpen)).Should(BeTrue())
+			Ω(atomic.LoadInt32(&dials)).Should(BeEquivalentTo(3))
+
+			// once Redis is back, a probe closes the breaker
+			atomic.StoreInt32(&down, 0)
+			time.Sleep(50 * time.Millisecond)
+			_, err = w.Ping()
+			Ω(errors.Is(err, ErrCircuitOpen)).Should(BeTrue())
+			Eventually(func() BreakerState {
+				return w.Stats().Breaker
+			}).Should(Equal(BreakerClosed))
+			Ω(w.Ping()).Should(Equal("PONG"))
+		})
+
+		It("should re-open when the probe fails", func() {
+			newWredis(BreakerPolicy{Failures: 1, Cooldown: 50 * time.Millisecond})
+
+			_, err := w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Stats().Breaker).Should(Equal(BreakerOpen))
+
+			time.Sleep(50 * time.Millisecond)
+			_, err = w.Ping()
+			Ω(errors.Is(err, ErrCircuitOpen)).Should(BeTrue())
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&dials)
+			}).Should(BeEquivalentTo(2))
+			Eventually(func() BreakerState {
+				return w.Stats().Breaker
+			}).Should(Equal(BreakerOpen))
+		})
+
+		It("should open once the error rate is exceeded", func() {
+			newWredis(BreakerPolicy{ErrorRate: 0.5, MinRequests: 4, Cooldown: time.Minute})
+			atomic.StoreInt32(&down, 0)
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(w.Ping()).Should(Equal("PONG"))
+
+			atomic.StoreInt32(&down, 1)
+			_, err := w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Stats().Breaker).Should(Equal(BreakerClosed))
+
+			_, err = w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Stats().Breaker).Should(Equal(BreakerOpen))
+		})
+
+		It("should not count error replies as failures", func() {
+			newWredis(BreakerPolicy{Failures: 1, Cooldown: time.Minute})
+			atomic.StoreInt32(&down, 0)
+
+			Ω(w.Set("wredis::test::breaker", "value")).Should(Succeed())
+			_, err := w.Incr("wredis::test::breaker")
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Stats().Breaker).Should(Equal(BreakerClosed))
+			Ω(w.Del("wredis::test::breaker")).Should(BeEquivalentTo(1))
+		})
+	})
+})
@@ -0,0 +1,269 @@
+package wredis
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// clusterSlotCount is the number of hash slots in a Redis Cluster
+const clusterSlotCount = 16384
+
+// crc16Table is the lookup table for CRC16-CCITT (XMODEM), as used by Redis
+// Cluster to hash keys to slots
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc16 returns the CRC16-CCITT (XMODEM) checksum of s
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// hashSlot returns the cluster hash slot of the key (or sharded channel). If
+// the key contains a non-empty "{...}" hash tag, only the tag is hashed.
+//
+// See: https://redis.io/docs/reference/cluster-spec/#hash-tags
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % clusterSlotCount
+}
+
+// sameSlot returns true if the keys, once prefixed, are all in the same slot;
+// which multi-key commands require in Cluster mode.
+func (w *impl) sameSlot(keys ...string) bool {
+	for i := 1; i < len(keys); i++ {
+		if hashSlot(w.cfg.KeyPrefix+keys[i]) != hashSlot(w.cfg.KeyPrefix+keys[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// slotRange is a range of slots, served by the node at addr
+type slotRange struct {
+	start, end int
+	addr       string
+}
+
+// clusterSlots maps the slots to the nodes serving them, as reported by
+// CLUSTER SLOTS, and holds a pool of connections to each node.
+type clusterSlots struct {
+	mu     sync.RWMutex
+	ranges []slotRange
+	pools  map[string]*redis.Pool // nil once closed
+}
+
+func newClusterSlots() *clusterSlots {
+	return &clusterSlots{pools: make(map[string]*redis.Pool)}
+}
+
+// node returns the addr of the node serving the slot, if it's known
+func (c *clusterSlots) node(slot int) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.ranges {
+		if slot >= r.start && slot <= r.end {
+			return r.addr, true
+		}
+	}
+	return "", false
+}
+
+// refresh replaces the slots using CLUSTER SLOTS, sent to the configured node
+func (c *clusterSlots) refresh(w *impl) error {
+	conn := w.pool.Get()
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return err
+	}
+
+	ranges := make([]slotRange, 0, len(reply))
+	for _, r := range reply {
+		values, err := redis.Values(r, nil)
+		if err != nil || len(values) < 3 {
+			return errors.New("wredis: invalid cluster slots reply")
+		}
+		start, err1 := redis.Int(values[0], nil)
+		end, err2 := redis.Int(values[1], nil)
+		master, err3 := redis.Values(values[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(master) < 2 {
+			return errors.New("wredis: invalid cluster slots reply")
+		}
+		host, err1 := redis.String(master[0], nil)
+		port, err2 := redis.Int(master[1], nil)
+		if err1 != nil || err2 != nil {
+			return errors.New("wredis: invalid cluster slots reply")
+		}
+		// an unknown host is the node we asked
+		if host == "" || host == "?" {
+			host = w.cfg.Host
+		}
+		ranges = append(ranges, slotRange{
+			start: start,
+			end:   end,
+			addr:  net.JoinHostPort(host, strconv.Itoa(port)),
+		})
+	}
+
+	c.mu.Lock()
+	c.ranges = ranges
+	c.mu.Unlock()
+	return nil
+}
+
+// conn returns a connection, from its pool, to the node at addr
+func (c *clusterSlots) conn(w *impl, addr string) redis.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pools == nil {
+		return errorConn{ErrClosed}
+	}
+	pool, ok := c.pools[addr]
+	if !ok {
+		cfg, err := w.cfg.node(addr)
+		if err != nil {
+			return errorConn{err}
+		}
+		pool = &redis.Pool{
+			MaxActive:       cfg.MaxActive,
+			MaxConnLifetime: cfg.MaxConnLifetime,
+			MaxIdle:         cfg.MaxIdle,
+			IdleTimeout:     cfg.IdleTimeout,
+			Dial:            cfg.Dialer(cfg),
+			TestOnBorrow:    cfg.testOnBorrow(),
+			Wait:            cfg.Wait,
+		}
+		c.pools[addr] = pool
+	}
+	return pool.Get()
+}
+
+// close closes the pools of connections to the nodes
+func (c *clusterSlots) close() {
+	c.mu.Lock()
+	pools := c.pools
+	c.pools = nil
+	c.mu.Unlock()
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// node returns a copy of the Config which connects to the node at addr, or
+// the Config itself if addr is empty
+func (c Config) node(addr string) (Config, error) {
+	if addr == "" {
+		return c, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return c, fmt.Errorf("wredis: invalid node %q", addr)
+	}
+	c.Host = host
+	if c.Port, err = strconv.Atoi(port); err != nil {
+		return c, fmt.Errorf("wredis: invalid node %q", addr)
+	}
+	return c, nil
+}
+
+// movedSlot returns the slot of a MOVED error, which Redis Cluster replies
+// with when the slot is served by another node
+func movedSlot(err error) (int, bool) {
+	rerr, ok := err.(redis.Error)
+	if !ok || !strings.HasPrefix(string(rerr), "MOVED ") {
+		return 0, false
+	}
+	fields := strings.Fields(string(rerr))
+	if len(fields) < 3 {
+		return 0, false
+	}
+	slot, err := strconv.Atoi(fields[1])
+	return slot, err == nil
+}
+
+// nodeConn returns a connection to the node serving the slot, discovering the
+// slots if they're not known
+func (w *impl) nodeConn(slot int) (redis.Conn, error) {
+	if atomic.LoadInt32(&w.closing) == 1 {
+		return nil, ErrClosed
+	}
+	addr, ok := w.slots.node(slot)
+	if !ok {
+		if err := w.slots.refresh(w); err != nil {
+			return nil, err
+		}
+		if addr, ok = w.slots.node(slot); !ok {
+			return nil, fmt.Errorf("wredis: no node serves slot %d", slot)
+		}
+	}
+	conn := w.slots.conn(w, addr)
+	if err := conn.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return w.wrap(conn), nil
+}
+
+// SPublish posts the message to the sharded channel, returning the number of
+// clients which received it. In Cluster mode, it's sent to the node serving
+// the channel's slot, rather than being broadcast to every node as with
+// Publish.
+//
+// See: https://redis.io/commands/spublish
+func (w *impl) SPublish(channel, message string) (int64, error) {
+	if empty(channel) {
+		return int64Err("wredis: empty channel")
+	}
+	if !w.cfg.Cluster {
+		return w.Int64(func(conn redis.Conn) (int64, error) {
+			return redis.Int64(conn.Do("SPUBLISH", channel, message))
+		})
+	}
+
+	slot := hashSlot(channel)
+	spublish := func() (int64, error) {
+		conn, err := w.nodeConn(slot)
+		if err != nil {
+			return 0, err
+		}
+		defer Close(conn)
+		return redis.Int64(conn.Do("SPUBLISH", channel, message))
+	}
+
+	// if the slot has moved, rediscover the slots and try again
+	n, err := spublish()
+	if _, moved := movedSlot(err); moved {
+		if err = w.slots.refresh(w); err != nil {
+			return 0, err
+		}
+		n, err = spublish()
+	}
+	return n, err
+}
@@ -0,0 +1,484 @@
+package wredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// commandFlag describes how a command behaves on a connection
+type commandFlag uint
+
+const (
+	// cmdBlocking commands may block the connection waiting for data
+	cmdBlocking commandFlag = 1 << iota
+	// cmdStateful commands change the state of the connection (transactions,
+	// pub/sub, the selected DB, ...) so later commands depend on it
+	cmdStateful
+	// cmdIdempotent commands can safely be sent more than once: reads, and
+	// writes which leave the same data however many times they're applied
+	cmdIdempotent
+)
+
+// commandCategory is a category of commands, which a Policy can allow or deny
+// using its "@name". They're similar to, but simpler than, Redis' ACL
+// categories.
+type commandCategory uint
+
+const (
+	catRead commandCategory = 1 << iota
+	catWrite
+	catAdmin
+	catDangerous
+	catPubSub
+	catScripting
+	catConnection
+	catTransaction
+	catBlocking
+)
+
+// categories are the names of the command categories
+var categories = map[string]commandCategory{
+	"@admin":       catAdmin,
+	"@blocking":    catBlocking,
+	"@connection":  catConnection,
+	"@dangerous":   catDangerous,
+	"@pubsub":      catPubSub,
+	"@read":        catRead,
+	"@scripting":   catScripting,
+	"@transaction": catTransaction,
+	"@write":       catWrite,
+}
+
+// keySpec describes where the keys are in a command's arguments (excluding
+// the command name): from first to last (negative counts back from the end of
+// the arguments), every step arguments. With numkeys, the argument at first is
+// the number of keys, which follow it. With streams, the keys are the first
+// half of the arguments after STREAMS (the rest are their IDs). With a
+// keyword, the keys start after it (searched for from the argument at from,
+// or backwards from the end if negative) rather than at first; and a last
+// which isn't negative counts from there.
+type keySpec struct {
+	first, last, step int
+	numkeys           bool
+	streams           bool
+	keyword           string
+	from              int
+}
+
+// common key specs
+var (
+	oneKey     = []keySpec{{first: 0, last: 0, step: 1}}
+	twoKeys    = []keySpec{{first: 0, last: 1, step: 1}}
+	allKeys    = []keySpec{{first: 0, last: -1, step: 1}}
+	pairKeys   = []keySpec{{first: 0, last: -1, step: 2}}
+	secondKey  = []keySpec{{first: 1, last: 1, step: 1}}
+	restKeys   = []keySpec{{first: 1, last: -1, step: 1}}
+	timeoutKey = []keySpec{{first: 0, last: -2, step: 1}}
+	firstNum   = []keySpec{{first: 0, numkeys: true}}
+	secondNum  = []keySpec{{first: 1, numkeys: true}}
+	storeNum   = []keySpec{{first: 0, last: 0, step: 1}, {first: 1, numkeys: true}}
+	streamKeys = []keySpec{{streams: true}}
+	sortKeys   = []keySpec{{first: 0, last: 0, step: 1}, {keyword: "STORE", from: 1, step: 1}}
+)
+
+// commandInfo is the metadata we keep about a Redis command
+type commandInfo struct {
+	flags commandFlag
+	cats  commandCategory
+	keys  []keySpec
+}
+
+// commands is the metadata for the commands we know of. Any command not listed
+// is a regular, non-blocking & stateless, command which is not idempotent; its
+// categories and keys are found using COMMAND INFO, see classify. Subcommands
+// are listed as "COMMAND|SUBCOMMAND", and only need the categories they add to
+// their command.
+var commands = map[string]commandInfo{
+	// idempotent reads
+	"BITCOUNT":    {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"BITFIELD_RO": {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"BITPOS":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"DBSIZE":      {flags: cmdIdempotent, cats: catRead},
+	"DUMP":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ECHO":        {flags: cmdIdempotent, cats: catConnection},
+	"EXISTS":      {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"EXPIRETIME":  {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"GET":         {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"GETBIT":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"GETRANGE":    {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HEXISTS":     {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HGET":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HGETALL":     {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HKEYS":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HLEN":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HMGET":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HRANDFIELD":  {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HSCAN":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HSTRLEN":     {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"HVALS":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"INFO":        {flags: cmdIdempotent, cats: catAdmin},
+	"KEYS":        {flags: cmdIdempotent, cats: catRead},
+	"LINDEX":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"LLEN":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"LPOS":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"LRANGE":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"MGET":        {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"PEXPIRETIME": {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"PFCOUNT":     {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"PING":        {flags: cmdIdempotent, cats: catConnection},
+	"PTTL":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"RANDOMKEY":   {flags: cmdIdempotent, cats: catRead},
+	"SCAN":        {flags: cmdIdempotent, cats: catRead},
+	"SCARD":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SDIFF":       {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"SINTER":      {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"SISMEMBER":   {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SMEMBERS":    {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SMISMEMBER":  {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SORT_RO":     {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SRANDMEMBER": {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SSCAN":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"STRLEN":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"SUNION":      {flags: cmdIdempotent, cats: catRead, keys: allKeys},
+	"TIME":        {flags: cmdIdempotent},
+	"TTL":         {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"TYPE":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"XINFO":       {flags: cmdIdempotent, cats: catRead, keys: secondKey},
+	"XLEN":        {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"XPENDING":    {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"XRANGE":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"XREVRANGE":   {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZCARD":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZCOUNT":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZLEXCOUNT":   {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZMSCORE":     {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZRANGE":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZRANK":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZREVRANGE":   {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZREVRANK":    {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZSCAN":       {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	"ZSCORE":      {flags: cmdIdempotent, cats: catRead, keys: oneKey},
+	// idempotent writes
+	"DEL":         {flags: cmdIdempotent, cats: catWrite, keys: allKeys},
+	"EXPIRE":      {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"EXPIREAT":    {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"FLUSHALL":    {flags: cmdIdempotent, cats: catWrite | catDangerous},
+	"FLUSHDB":     {flags: cmdIdempotent, cats: catWrite | catDangerous},
+	"HDEL":        {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"HMSET":       {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"HSET":        {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"MSET":        {flags: cmdIdempotent, cats: catWrite, keys: pairKeys},
+	"PERSIST":     {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"PEXPIREAT":   {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"PFADD":       {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"PSETEX":      {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SADD":        {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SDIFFSTORE":  {flags: cmdIdempotent, cats: catWrite, keys: allKeys},
+	"SET":         {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SETBIT":      {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SETEX":       {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SINTERSTORE": {flags: cmdIdempotent, cats: catWrite, keys: allKeys},
+	"SREM":        {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	"SUNIONSTORE": {flags: cmdIdempotent, cats: catWrite, keys: allKeys},
+	"UNLINK":      {flags: cmdIdempotent, cats: catWrite, keys: allKeys},
+	"ZREM":        {flags: cmdIdempotent, cats: catWrite, keys: oneKey},
+	// writes
+	"APPEND":           {cats: catWrite, keys: oneKey},
+	"BITFIELD":         {cats: catWrite, keys: oneKey},
+	"BITOP":            {cats: catWrite, keys: restKeys},
+	"COPY":             {cats: catWrite, keys: twoKeys},
+	"DECR":             {cats: catWrite, keys: oneKey},
+	"DECRBY":           {cats: catWrite, keys: oneKey},
+	"GETDEL":           {cats: catWrite, keys: oneKey},
+	"GETEX":            {cats: catWrite, keys: oneKey},
+	"GETSET":           {cats: catWrite, keys: oneKey},
+	"HINCRBY":          {cats: catWrite, keys: oneKey},
+	"HINCRBYFLOAT":     {cats: catWrite, keys: oneKey},
+	"HSETNX":           {cats: catWrite, keys: oneKey},
+	"INCR":             {cats: catWrite, keys: oneKey},
+	"INCRBY":           {cats: catWrite, keys: oneKey},
+	"INCRBYFLOAT":      {cats: catWrite, keys: oneKey},
+	"LINSERT":          {cats: catWrite, keys: oneKey},
+	"LMOVE":            {cats: catWrite, keys: twoKeys},
+	"LMPOP":            {cats: catWrite, keys: firstNum},
+	"LPOP":             {cats: catWrite, keys: oneKey},
+	"LPUSH":            {cats: catWrite, keys: oneKey},
+	"LPUSHX":           {cats: catWrite, keys: oneKey},
+	"LREM":             {cats: catWrite, keys: oneKey},
+	"LSET":             {cats: catWrite, keys: oneKey},
+	"LTRIM":            {cats: catWrite, keys: oneKey},
+	"MOVE":             {cats: catWrite, keys: oneKey},
+	"MSETNX":           {cats: catWrite, keys: pairKeys},
+	"PEXPIRE":          {cats: catWrite, keys: oneKey},
+	"PFMERGE":          {cats: catWrite, keys: allKeys},
+	"RENAME":           {cats: catWrite, keys: twoKeys},
+	"RENAMENX":         {cats: catWrite, keys: twoKeys},
+	"RESTORE":          {cats: catWrite, keys: oneKey},
+	"RPOP":             {cats: catWrite, keys: oneKey},
+	"RPOPLPUSH":        {cats: catWrite, keys: twoKeys},
+	"RPUSH":            {cats: catWrite, keys: oneKey},
+	"RPUSHX":           {cats: catWrite, keys: oneKey},
+	"SETNX":            {cats: catWrite, keys: oneKey},
+	"SETRANGE":         {cats: catWrite, keys: oneKey},
+	"SMOVE":            {cats: catWrite, keys: twoKeys},
+	"SORT":             {cats: catWrite, keys: sortKeys},
+	"SPOP":             {cats: catWrite, keys: oneKey},
+	"SWAPDB":           {cats: catWrite | catDangerous},
+	"XACK":             {cats: catWrite, keys: oneKey},
+	"XADD":             {cats: catWrite, keys: oneKey},
+	"XAUTOCLAIM":       {cats: catWrite, keys: oneKey},
+	"XCLAIM":           {cats: catWrite, keys: oneKey},
+	"XDEL":             {cats: catWrite, keys: oneKey},
+	"XGROUP":           {cats: catWrite, keys: secondKey},
+	"XREAD":            {cats: catRead, keys: streamKeys},
+	"XREADGROUP":       {cats: catWrite, keys: streamKeys},
+	"XSETID":           {cats: catWrite, keys: oneKey},
+	"XTRIM":            {cats: catWrite, keys: oneKey},
+	"ZADD":             {cats: catWrite, keys: oneKey},
+	"ZDIFFSTORE":       {cats: catWrite, keys: storeNum},
+	"ZINCRBY":          {cats: catWrite, keys: oneKey},
+	"ZINTERSTORE":      {cats: catWrite, keys: storeNum},
+	"ZMPOP":            {cats: catWrite, keys: firstNum},
+	"ZPOPMAX":          {cats: catWrite, keys: oneKey},
+	"ZPOPMIN":          {cats: catWrite, keys: oneKey},
+	"ZREMRANGEBYLEX":   {cats: catWrite, keys: oneKey},
+	"ZREMRANGEBYRANK":  {cats: catWrite, keys: oneKey},
+	"ZREMRANGEBYSCORE": {cats: catWrite, keys: oneKey},
+	"ZUNIONSTORE":      {cats: catWrite, keys: storeNum},
+	// pub/sub & scripting
+	"EVAL":            {cats: catScripting | catWrite, keys: secondNum},
+	"EVAL_RO":         {cats: catScripting | catRead, keys: secondNum},
+	"EVALSHA":         {cats: catScripting | catWrite, keys: secondNum},
+	"EVALSHA_RO":      {cats: catScripting | catRead, keys: secondNum},
+	"FCALL":           {cats: catScripting | catWrite, keys: secondNum},
+	"FCALL_RO":        {cats: catScripting | catRead, keys: secondNum},
+	"FUNCTION":        {cats: catScripting},
+	"FUNCTION|DELETE": {cats: catDangerous},
+	"FUNCTION|FLUSH":  {cats: catDangerous},
+	"PUBLISH":         {cats: catPubSub},
+	"SCRIPT":          {cats: catScripting},
+	"SCRIPT|FLUSH":    {cats: catDangerous},
+	"SPUBLISH":        {cats: catPubSub},
+	// blocking
+	"BLMOVE":     {flags: cmdBlocking, cats: catWrite, keys: twoKeys},
+	"BLMPOP":     {flags: cmdBlocking, cats: catWrite, keys: secondNum},
+	"BLPOP":      {flags: cmdBlocking, cats: catWrite, keys: timeoutKey},
+	"BRPOP":      {flags: cmdBlocking, cats: catWrite, keys: timeoutKey},
+	"BRPOPLPUSH": {flags: cmdBlocking, cats: catWrite, keys: twoKeys},
+	"BZMPOP":     {flags: cmdBlocking, cats: catWrite, keys: secondNum},
+	"BZPOPMAX":   {flags: cmdBlocking, cats: catWrite, keys: timeoutKey},
+	"BZPOPMIN":   {flags: cmdBlocking, cats: catWrite, keys: timeoutKey},
+	"WAIT":       {flags: cmdBlocking},
+	"WAITAOF":    {flags: cmdBlocking},
+	// stateful
+	"AUTH":         {flags: cmdStateful, cats: catConnection},
+	"CLIENT":       {flags: cmdStateful, cats: catConnection},
+	"CLIENT|KILL":  {cats: catAdmin | catDangerous},
+	"DISCARD":      {flags: cmdStateful, cats: catTransaction},
+	"EXEC":         {flags: cmdStateful, cats: catTransaction},
+	"HELLO":        {flags: cmdStateful, cats: catConnection},
+	"MONITOR":      {flags: cmdStateful | cmdBlocking, cats: catAdmin | catDangerous},
+	"MULTI":        {flags: cmdStateful, cats: catTransaction},
+	"PSUBSCRIBE":   {flags: cmdStateful | cmdBlocking, cats: catPubSub},
+	"PUNSUBSCRIBE": {flags: cmdStateful, cats: catPubSub},
+	"QUIT":         {flags: cmdStateful, cats: catConnection},
+	"READONLY":     {flags: cmdStateful, cats: catConnection},
+	"READWRITE":    {flags: cmdStateful, cats: catConnection},
+	"RESET":        {flags: cmdStateful, cats: catConnection},
+	"SELECT":       {flags: cmdStateful, cats: catConnection},
+	"SSUBSCRIBE":   {flags: cmdStateful | cmdBlocking, cats: catPubSub},
+	"SUBSCRIBE":    {flags: cmdStateful | cmdBlocking, cats: catPubSub},
+	"SUNSUBSCRIBE": {flags: cmdStateful, cats: catPubSub},
+	"UNSUBSCRIBE":  {flags: cmdStateful, cats: catPubSub},
+	"UNWATCH":      {flags: cmdStateful, cats: catTransaction},
+	"WATCH":        {flags: cmdStateful, cats: catTransaction, keys: allKeys},
+	// server
+	"ACL":              {cats: catAdmin},
+	"BGREWRITEAOF":     {cats: catAdmin},
+	"BGSAVE":           {cats: catAdmin},
+	"CLUSTER":          {cats: catAdmin},
+	"COMMAND":          {cats: catConnection},
+	"CONFIG":           {cats: catAdmin},
+	"CONFIG|RESETSTAT": {cats: catDangerous},
+	"CONFIG|REWRITE":   {cats: catDangerous},
+	"CONFIG|SET":       {cats: catDangerous},
+	"DEBUG":            {cats: catAdmin | catDangerous},
+	"FAILOVER":         {cats: catAdmin | catDangerous},
+	"LASTSAVE":         {cats: catAdmin},
+	"LATENCY":          {cats: catAdmin},
+	"MODULE":           {cats: catAdmin | catDangerous},
+	"REPLICAOF":        {cats: catAdmin | catDangerous},
+	"SAVE":             {cats: catAdmin},
+	"SHUTDOWN":         {cats: catAdmin | catDangerous},
+	"SLAVEOF":          {cats: catAdmin | catDangerous},
+	"SLOWLOG":          {cats: catAdmin},
+}
+
+// lookupCommand returns the metadata for the command
+func lookupCommand(cmd string) commandInfo {
+	info, _ := listedCommand(cmd)
+	return info
+}
+
+// listedCommand returns the metadata for the command, and whether it's listed
+func listedCommand(cmd string) (commandInfo, bool) {
+	if info, ok := commands[cmd]; ok {
+		return info, true
+	}
+	info, ok := commands[strings.ToUpper(cmd)]
+	return info, ok
+}
+
+// parents are the commands with subcommands in the table
+var parents = func() map[string]bool {
+	parents := make(map[string]bool)
+	for name := range commands {
+		if i := strings.IndexByte(name, '|'); i > 0 {
+			parents[name[:i]] = true
+		}
+	}
+	return parents
+}()
+
+// hasSubcommands returns true if the command has subcommands we know of
+func hasSubcommands(cmd string) bool {
+	return parents[cmd] || parents[strings.ToUpper(cmd)]
+}
+
+// subcommand returns the "COMMAND|SUBCOMMAND" name of the command, if its
+// first argument is a (string) subcommand we know of
+func subcommand(cmd string, args []interface{}) (string, bool) {
+	if len(args) == 0 || !hasSubcommands(cmd) {
+		return "", false
+	}
+	var sub string
+	switch arg := args[0].(type) {
+	case string:
+		sub = arg
+	case []byte:
+		sub = string(arg)
+	default:
+		return "", false
+	}
+	name := strings.ToUpper(cmd) + "|" + strings.ToUpper(sub)
+	_, ok := commands[name]
+	return name, ok
+}
+
+// categoriesOf returns the categories of the command, and its subcommand
+func categoriesOf(cmd string, args []interface{}) commandCategory {
+	info := lookupCommand(cmd)
+	cats := info.cats
+	if info.flags&cmdBlocking != 0 {
+		cats |= catBlocking
+	}
+	if name, ok := subcommand(cmd, args); ok {
+		cats |= commands[name].cats
+	}
+	return cats
+}
+
+// findKeys returns the indexes of the keys, as given by the specs, in the n
+// arguments; arg returns the i'th argument.
+func findKeys(specs []keySpec, n int, arg func(i int) string) []int {
+	var indexes []int
+	for _, spec := range specs {
+		if spec.streams {
+			for i := 0; i < n; i++ {
+				if strings.EqualFold(arg(i), "STREAMS") {
+					keys := (n - i - 1) / 2
+					for j := i + 1; j <= i+keys; j++ {
+						indexes = append(indexes, j)
+					}
+					break
+				}
+			}
+			continue
+		}
+		if spec.numkeys {
+			if spec.first >= n {
+				continue
+			}
+			keys, err := strconv.Atoi(arg(spec.first))
+			if err != nil {
+				continue
+			}
+			for i := spec.first + 1; i <= spec.first+keys && i < n; i++ {
+				indexes = append(indexes, i)
+			}
+			continue
+		}
+
+		first, last := spec.first, spec.last
+		if spec.keyword != "" {
+			var ok bool
+			if first, ok = spec.afterKeyword(n, arg); !ok {
+				continue
+			}
+			if last >= 0 {
+				last += first
+			}
+		}
+		if last < 0 {
+			last += n
+		}
+		for i := first; i <= last && i < n; i += spec.step {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// afterKeyword returns the index of the argument after the spec's keyword
+func (spec keySpec) afterKeyword(n int, arg func(i int) string) (int, bool) {
+	if spec.from >= 0 {
+		for i := spec.from; i < n; i++ {
+			if strings.EqualFold(arg(i), spec.keyword) {
+				return i + 1, true
+			}
+		}
+		return 0, false
+	}
+	for i := n + spec.from; i >= 0; i-- {
+		if strings.EqualFold(arg(i), spec.keyword) {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// argString returns the argument as it would be sent to Redis
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case int:
+		return strconv.Itoa(arg)
+	case int64:
+		return strconv.FormatInt(arg, 10)
+	case uint:
+		return strconv.FormatUint(uint64(arg), 10)
+	}
+	return fmt.Sprint(arg)
+}
+
+// dedicated returns true if the command must be sent on a connection of its
+// own: it either blocks the connection, or changes its state. XREAD(GROUP)
+// only block when called with the BLOCK option.
+func dedicated(cmd string, args []interface{}) bool {
+	if lookupCommand(cmd).flags&(cmdBlocking|cmdStateful) != 0 {
+		return true
+	}
+	switch strings.ToUpper(cmd) {
+	case "XREAD", "XREADGROUP":
+		for _, arg := range args {
+			if s, ok := arg.(string); ok && strings.EqualFold(s, "BLOCK") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,36 +1,67 @@
 package wredis
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
 )
 
-// Config for configuration
+// Config for configuration. The `config` struct tags name the values that can
+// be loaded using FromEnv and FromFile, where "-" cannot be loaded.
 type Config struct {
-	Cluster         bool
-	DB              uint
-	Dialer          func(Config) dialFunc
-	Host            string
-	IdleTimeout     time.Duration
-	MaxActive       int
-	MaxConnLifetime time.Duration
-	MaxIdle         int
-	Password        string
-	Port            int
-	TestOnBorrower  func(Config) borrowFunc
-	Wait            bool
+	AutoPipeline        int                     `config:"auto_pipeline"`
+	BreakerPolicy       BreakerPolicy           `config:"-"`
+	Cluster             bool                    `config:"cluster"`
+	CredentialsProvider CredentialsProvider     `config:"-"`
+	CredentialsRefresh  time.Duration           `config:"credentials_refresh"`
+	DB                  uint                    `config:"db"`
+	Dialer              func(Config) dialFunc   `config:"-"`
+	Host                string                  `config:"host"`
+	IdleTimeout         time.Duration           `config:"idle_timeout"`
+	InsecureSkipVerify  bool                    `config:"insecure_skip_verify"`
+	KeyPrefix           string                  `config:"key_prefix"`
+	MaxActive           int                     `config:"max_active"`
+	MaxConnLifetime     time.Duration           `config:"max_conn_lifetime"`
+	MaxIdle             int                     `config:"max_idle"`
+	MinIdle             int                     `config:"min_idle"`
+	NetDialer           NetDialFunc             `config:"-"`
+	Network             string                  `config:"network"`
+	Password            string                  `config:"password,secret"`
+	PipelineBatch       int                     `config:"pipeline_batch"`
+	PipelineWindow      time.Duration           `config:"pipeline_window"`
+	Policy              Policy                  `config:"-"`
+	PubSubPing          time.Duration           `config:"pubsub_ping"`
+	Port                int                     `config:"port"`
+	Protocol            int                     `config:"protocol"`
+	PushHandler         func([]interface{})     `config:"-"`
+	ReadOnly            bool                    `config:"read_only"`
+	RetryPolicy         RetryPolicy             `config:"-"`
+	ServerName          string                  `config:"server_name"`
+	Socket              string                  `config:"socket"`
+	TestOnBorrower      func(Config) borrowFunc `config:"-"`
+	TLS                 *tls.Config             `config:"-"`
+	Username            string                  `config:"username"`
+	Wait                bool                    `config:"wait"`
 	// private config options
+	native      bool // connections are dialed by wredis, so are *respConn
 	selectable  bool
+	tlsFiles    *tlsFiles
 	transacting bool
 }
 
 var nilCfg = Config{}
 
-// Addr return the host:port address from the Config
+// Addr return the host:port address from the Config, or the Socket path for
+// unix connections
 func (c Config) Addr() string {
+	if c.Network == "unix" {
+		return c.Socket
+	}
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
@@ -39,20 +70,43 @@ func (c Config) Addr() string {
 func (c Config) Copy(opts ...Option) (Config, error) {
 	// Copy current config
 	cfg := Config{
-		Cluster:         c.Cluster,
-		DB:              c.DB,
-		Dialer:          c.Dialer,
-		Host:            c.Host,
-		IdleTimeout:     c.IdleTimeout,
-		MaxActive:       c.MaxActive,
-		MaxConnLifetime: c.MaxConnLifetime,
-		MaxIdle:         c.MaxIdle,
-		Password:        c.Password,
-		Port:            c.Port,
-		TestOnBorrower:  c.TestOnBorrower,
-		Wait:            c.Wait,
+		AutoPipeline:        c.AutoPipeline,
+		BreakerPolicy:       c.BreakerPolicy,
+		Cluster:             c.Cluster,
+		CredentialsProvider: c.CredentialsProvider,
+		CredentialsRefresh:  c.CredentialsRefresh,
+		DB:                  c.DB,
+		Dialer:              c.Dialer,
+		Host:                c.Host,
+		IdleTimeout:         c.IdleTimeout,
+		InsecureSkipVerify:  c.InsecureSkipVerify,
+		KeyPrefix:           c.KeyPrefix,
+		MaxActive:           c.MaxActive,
+		MaxConnLifetime:     c.MaxConnLifetime,
+		MaxIdle:             c.MaxIdle,
+		MinIdle:             c.MinIdle,
+		NetDialer:           c.NetDialer,
+		Network:             c.Network,
+		Password:            c.Password,
+		PipelineBatch:       c.PipelineBatch,
+		PipelineWindow:      c.PipelineWindow,
+		Policy:              c.Policy,
+		PubSubPing:          c.PubSubPing,
+		Port:                c.Port,
+		Protocol:            c.Protocol,
+		PushHandler:         c.PushHandler,
+		ReadOnly:            c.ReadOnly,
+		RetryPolicy:         c.RetryPolicy,
+		ServerName:          c.ServerName,
+		Socket:              c.Socket,
+		TestOnBorrower:      c.TestOnBorrower,
+		TLS:                 c.TLS,
+		Username:            c.Username,
+		Wait:                c.Wait,
 		// private config options
+		native:      c.native,
 		selectable:  c.selectable,
+		tlsFiles:    c.tlsFiles,
 		transacting: c.transacting,
 	}
 
@@ -81,6 +135,42 @@ func (c Config) Validate() error {
 		return errors.New("wredis: cluster supports db/0 only")
 	}
 
+	if c.Protocol != 2 && c.Protocol != 3 {
+		return errors.New("wredis: invalid protocol")
+	}
+
+	if err := validatePipeline(c.AutoPipeline, c.PipelineWindow, c.PipelineBatch); err != nil {
+		return err
+	}
+
+	if c.MinIdle > c.MaxIdle {
+		return errors.New("wredis: min idle exceeds max idle")
+	}
+
+	// unix sockets have no host or port to validate
+	if c.Network == "unix" {
+		if empty(c.Socket) {
+			return errors.New("wredis: empty socket")
+		}
+		return nil
+	}
+
+	// any other network requires a NetDialer to connect
+	switch c.Network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		if c.NetDialer == nil {
+			return fmt.Errorf("wredis: unsupported network %q", c.Network)
+		}
+	}
+	if empty(c.Host) {
+		return errors.New("wredis: empty host")
+	}
+	// disallow reserved ports
+	if c.Port <= 1023 || c.Port > 65535 {
+		return errors.New("wredis: invalid port")
+	}
+
 	return nil
 }
 
@@ -95,9 +185,15 @@ func defaultConfig() Config {
 		MaxActive:       10,
 		MaxConnLifetime: time.Hour,
 		MaxIdle:         3,
+		Network:         "tcp",
+		PipelineBatch:   128,
+		Policy:          SafePolicy(),
+		PubSubPing:      30 * time.Second,
 		Port:            6379,
+		Protocol:        2,
 		Wait:            false,
 		// private config options
+		native:      true,
 		transacting: false,
 		selectable:  true,
 	}
@@ -120,34 +216,41 @@ func newConfig(opts ...Option) (Config, error) {
 		}
 	}
 
-	return cfg, nil
+	return cfg, cfg.Validate()
 }
 
 type dialFunc func() (redis.Conn, error)
 
+// NetDialFunc dials the underlying net.Conn for a new connection. It can be
+// used to connect via a proxy or over a custom transport.
+type NetDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 func defaultDialer(cfg Config) dialFunc {
 	return func() (redis.Conn, error) {
-		conn, err := redis.Dial("tcp", cfg.Addr(), redis.DialDatabase(int(cfg.DB)))
+		conn, err := cfg.dial()
 		if err != nil {
 			return nil, err
 		}
-		// ensure connection is AUTH'd
-		if cfg.Password != "" {
-			_, err = conn.Do("AUTH", cfg.Password)
-			if err != nil {
-				return nil, err
-			}
-		}
 		// ensure we're SELECTing the configured DB
 		_, err = conn.Do("SELECT", cfg.DB)
 		if err != nil {
+			conn.Close()
 			return nil, err
 		}
+		// track when the connection was AUTH'd, to refresh its credentials
+		if cfg.reauthenticates() {
+			return &authConn{Conn: conn, authed: time.Now()}, nil
+		}
 		// return this connection
 		return conn, nil
 	}
 }
 
+// dial connects to the configured Addr, and AUTHs the connection
+func (c Config) dial() (redis.Conn, error) {
+	return dialResp(c)
+}
+
 type borrowFunc func(redis.Conn, time.Time) error
 
 func noopTestOnBorrower(cfg Config) borrowFunc {
@@ -169,8 +272,9 @@ func transacting() Option {
 // unselectable disallows the use of Select. It is a guard against being able
 // to call Select against an instance of Wredis returned by a call to Select;
 //
-// NOTE: this might run into a conflict if the DBSWAP command is used, as the
-//       data being returned will be from the swapped database.
+// NOTE: if SWAPDB is used, the data being returned will be from the swapped
+// database; which is why a Select'd Wredis fails with ErrDBSwapped once its DB
+// is swapped using SwapDB.
 func unselectable() Option {
 	return func(cfg Config) (Config, error) {
 		cfg.selectable = false
@@ -206,10 +310,12 @@ func DB(db uint) Option {
 	}
 }
 
-// Dialer sets the Dialer function in the Config
+// Dialer sets the Dialer function in the Config. Since the dialed connections
+// may be of any type, the native RESP reader/writer is not used for them.
 func Dialer(dialer func(Config) dialFunc) Option {
 	return func(cfg Config) (Config, error) {
 		cfg.Dialer = dialer
+		cfg.native = false
 		return cfg, nil
 	}
 }
@@ -268,6 +374,30 @@ func Password(pass string) Option {
 	}
 }
 
+// NetDialer sets the NetDialer function in the Config, which is used in place
+// of a net.Dialer to connect to the configured Addr.
+func NetDialer(dial NetDialFunc) Option {
+	return func(cfg Config) (Config, error) {
+		if dial == nil {
+			return cfg, errors.New("wredis: nil net dialer")
+		}
+		cfg.NetDialer = dial
+		return cfg, nil
+	}
+}
+
+// Network sets the Network in the Config (e.g. "tcp" or "unix"). Networks
+// other than tcp & unix are only supported with a NetDialer.
+func Network(network string) Option {
+	return func(cfg Config) (Config, error) {
+		if empty(network) {
+			return cfg, errors.New("wredis: empty network")
+		}
+		cfg.Network = network
+		return cfg, nil
+	}
+}
+
 // Port sets the Port in the Config
 func Port(port int) Option {
 	// disallow reserved ports
@@ -280,6 +410,18 @@ func Port(port int) Option {
 	}
 }
 
+// Socket sets the Socket path in the Config, and sets the Network to "unix"
+func Socket(path string) Option {
+	return func(cfg Config) (Config, error) {
+		if empty(path) {
+			return cfg, errors.New("wredis: empty socket")
+		}
+		cfg.Network = "unix"
+		cfg.Socket = path
+		return cfg, nil
+	}
+}
+
 // TestOnBorrower sets the TestOnBorrower function in the Config
 func TestOnBorrower(borrower func(Config) borrowFunc) Option {
 	return func(cfg Config) (Config, error) {
@@ -288,6 +430,19 @@ func TestOnBorrower(borrower func(Config) borrowFunc) Option {
 	}
 }
 
+// Warmup sets the MinIdle in the Config, the number of connections which are
+// dialed when the pool is created; so the first commands don't wait to dial.
+// Creating the pool fails if none of them can be dialed.
+func Warmup(n int) Option {
+	return func(cfg Config) (Config, error) {
+		if n < 0 {
+			return cfg, errors.New("wredis: invalid warmup")
+		}
+		cfg.MinIdle = n
+		return cfg, nil
+	}
+}
+
 // Wait sets the Wait in the Config
 func Wait(wait bool) Option {
 	return func(cfg Config) (Config, error) {
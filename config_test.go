@@ -1,6 +1,14 @@
 package wredis_test
 
 import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/crowdriff/wredis"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -23,4 +31,82 @@ var _ = Describe("Config", func() {
 		Ω(err).Should(HaveOccurred())
 		Ω(err.Error()).Should(Equal("wredis: no select"))
 	})
+
+	Context("Network", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "wredis-network")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(dir)).Should(Succeed())
+		})
+
+		It("should connect over a unix socket", func() {
+			path := filepath.Join(dir, "redis.sock")
+			server, err := newFakeUnixServer(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer server.Close()
+
+			w, err := Safe(Socket(path), DB(2))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(server.Commands()).Should(ContainElement([]string{"SELECT", "2"}))
+		})
+
+		It("should not validate the port of a unix socket", func() {
+			cfg, err := ParseURL("unix:///var/run/redis.sock")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			cfg.Port = 0
+			Ω(cfg.Validate()).Should(Succeed())
+		})
+
+		It("should fail given an empty socket", func() {
+			_, err := Safe(Socket(""))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: empty socket"))
+		})
+
+		It("should only allow other networks with a NetDialer", func() {
+			cfg, err := ParseURL("redis://")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = cfg.Copy(Network("vsock"))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: unsupported network "vsock"`))
+
+			_, err = cfg.Copy(Network("vsock"), NetDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return nil, nil
+			}))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should connect using the NetDialer", func() {
+			server, err := newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer server.Close()
+
+			var dialed []string
+			w, err := Safe(
+				Host("redis.proxied"),
+				Port(6379),
+				NetDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+					dialed = append(dialed, network+"://"+addr)
+					var d net.Dialer
+					return d.DialContext(ctx, "tcp", server.Addr())
+				}),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(dialed).Should(Equal([]string{"tcp://redis.proxied:6379"}))
+		})
+	})
 })
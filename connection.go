@@ -2,6 +2,9 @@ package wredis
 
 import (
 	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/garyburd/redigo/redis"
 )
@@ -53,35 +56,119 @@ func (w *impl) Quit() error {
 //
 // NOTE: Implementation Details
 //
-// 1. Select only modifes the "current" Connection
-// 2. We will return a new Wredis object that is *NOT* Selectable
+//  1. Select only modifes the "current" Connection
+//  2. We will return a new Wredis object that is *NOT* Selectable
+//  3. The returned Wredis does not auto pipeline
+//  4. The Wredis for each DB is cached, so Select can be called per request;
+//     its pool is sized like ours, and it is closed by our Close (calling its
+//     own Close does nothing)
+//  5. Once its DB is swapped by SwapDB, the Wredis fails with ErrDBSwapped;
+//     Select the DB again to acknowledge the swap, and continue using it
 func (w *impl) Select(db uint) (Wredis, error) {
 	// Cannot call select in Cluster mode
 	if !w.selectable() {
 		return nil, errors.New("wredis: no select")
 	}
 
-	// this will return a Wredis whose underlying pool contains 1 allowable
-	// active connection that will never idle or timeout
+	w.dbsMu.Lock()
+	defer w.dbsMu.Unlock()
+	if w.dbs == nil {
+		return nil, ErrClosed
+	}
+	if child, ok := w.dbs[db]; ok {
+		atomic.StoreUint64(&child.generation, w.swaps.get(db))
+		return child, nil
+	}
+
+	// this will return a Wredis whose underlying pool is configured like our
+	// own, except that it is for the selected DB
 	cfg, err := w.cfg.Copy(
+		AutoPipeline(0, 0, 0),
 		DB(db),
-		IdleTimeout(0),
-		MaxActive(1),
-		MaxConnLifetime(0),
-		MaxIdle(0),
-		Wait(false),
+		Warmup(0),
 		unselectable(),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// create and return our single connection Pool
-	pool, err := newPoolClient(cfg)
+	// create, cache and return the Pool
+	child, err := newPoolClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return pool, nil
+	child.parent = w
+	child.swaps = w.swaps
+	child.server = w.server
+	child.generation = w.swaps.get(db)
+	w.dbs[db] = child
+	return child, nil
+}
+
+// DB returns the Wredis for the DB, if it has been opened by Select.
+func (w *impl) DB(db uint) (Wredis, bool) {
+	w.dbsMu.Lock()
+	defer w.dbsMu.Unlock()
+	child, ok := w.dbs[db]
+	if !ok {
+		return nil, false
+	}
+	return child, true
+}
+
+// OpenDBs returns the DBs which have been opened by Select, in order.
+func (w *impl) OpenDBs() []uint {
+	w.dbsMu.Lock()
+	defer w.dbsMu.Unlock()
+	dbs := make([]uint, 0, len(w.dbs))
+	for db := range w.dbs {
+		dbs = append(dbs, db)
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i] < dbs[j] })
+	return dbs
+}
+
+// ErrDBSwapped is returned by a Wredis returned by Select once its DB has been
+// swapped by SwapDB, as its data is now that of another DB. Calling Select
+// again acknowledges the swap.
+//
+// NOTE: only swaps made using SwapDB, on this Wredis or one Select'd from it,
+// are detected; not those made by other clients.
+var ErrDBSwapped = errors.New("wredis: db swapped")
+
+// generations counts the swaps of each DB. It is shared by a Wredis and those
+// Select'd from it, which compare the generation of their DB with the one it
+// had when they were Select'd.
+type generations struct {
+	mu  sync.Mutex
+	gen map[uint]uint64
+}
+
+func newGenerations() *generations {
+	return &generations{gen: make(map[uint]uint64)}
+}
+
+// get returns the generation of the DB
+func (g *generations) get(db uint) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.gen[db]
+}
+
+// swap records that the DBs have been swapped
+func (g *generations) swap(a, b uint) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen[a]++
+	g.gen[b]++
+}
+
+// swapped returns true if we were Select'd, and our DB has since been swapped
+func (w *impl) swapped() bool {
+	if w.parent == nil {
+		return false
+	}
+	return atomic.LoadUint64(&w.generation) != w.swaps.get(w.cfg.DB)
 }
 
 // selectable returns if we can Select on this client.
@@ -1,6 +1,10 @@
 package wredis_test
 
 import (
+	"sync"
+
+	. "github.com/crowdriff/wredis"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -24,5 +28,75 @@ var _ = Describe("Connection", func() {
 			Ω(err).Should(HaveOccurred())
 			Ω(err.Error()).Should(Equal("wredis: no select"))
 		})
+
+		Context("cached", func() {
+			var w Wredis
+
+			BeforeEach(func() {
+				var err error
+				w, err = Safe()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Ω(w.Close()).Should(Succeed())
+			})
+
+			It("should return the same Wredis for a DB", func() {
+				var (
+					wg  sync.WaitGroup
+					mu  sync.Mutex
+					dbs []Wredis
+				)
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						db, err := w.Select(1)
+						Ω(err).ShouldNot(HaveOccurred())
+						mu.Lock()
+						dbs = append(dbs, db)
+						mu.Unlock()
+					}()
+				}
+				wg.Wait()
+
+				for _, db := range dbs {
+					Ω(db).Should(BeIdenticalTo(dbs[0]))
+				}
+			})
+
+			It("should list the open DBs", func() {
+				_, ok := w.DB(2)
+				Ω(ok).Should(BeFalse())
+				Ω(w.OpenDBs()).Should(BeEmpty())
+
+				db2, err := w.Select(2)
+				Ω(err).ShouldNot(HaveOccurred())
+				_, err = w.Select(1)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				db, ok := w.DB(2)
+				Ω(ok).Should(BeTrue())
+				Ω(db).Should(BeIdenticalTo(db2))
+				Ω(w.OpenDBs()).Should(Equal([]uint{1, 2}))
+			})
+
+			It("should only be closed along with its parent", func() {
+				db, err := w.Select(1)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(db.Close()).Should(Succeed())
+				Ω(db.Ping()).Should(Equal("PONG"))
+
+				Ω(w.Close()).Should(Succeed())
+				_, err = db.Ping()
+				Ω(err).Should(HaveOccurred())
+
+				_, err = w.Select(1)
+				Ω(err).Should(Equal(ErrClosed))
+			})
+		})
 	})
 })
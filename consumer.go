@@ -0,0 +1,221 @@
+package wredis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsumerHandler processes an entry read by a Consumer. The entry is
+// acknowledged if it returns nil, otherwise it's left pending so it's
+// redelivered once its VisibilityTimeout has passed.
+type ConsumerHandler func(context.Context, StreamEntry) error
+
+// ConsumerOptions are the options of a Consumer
+type ConsumerOptions struct {
+	// Stream, Group and Name are the stream read, the consumer group it's read
+	// as, and the Consumer's name in the group; all of which are required
+	Stream string
+	Group  string
+	Name   string
+	// Handler processes the entries, and is required
+	Handler ConsumerHandler
+
+	// StartID is the ID the group starts reading after, if Run creates it;
+	// where "$", or an empty StartID, only reads new entries
+	StartID string
+	// Count is the most entries read at once, 10 if 0
+	Count int
+	// Block is how long each read waits for entries, and so how long Run may
+	// take to return once its context is done; 5 seconds if 0
+	Block time.Duration
+	// VisibilityTimeout is how long an entry can be pending, before it's
+	// claimed from the consumer it was delivered to (which may have died) and
+	// redelivered; 30 seconds if 0
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is the number of deliveries after which an entry, which
+	// still hasn't been acknowledged, is moved to the DeadLetterStream; 0 never
+	// moves them
+	MaxDeliveries int64
+	// DeadLetterStream is the stream dead entries are added to; the Stream
+	// suffixed with ":dead" if empty. Dead entries keep their fields, and gain
+	// an "orig_id", "stream" and "deliveries"
+	DeadLetterStream string
+}
+
+// Consumer reads the entries of a stream as a consumer of a group, passing
+// them to its Handler and acknowledging them once they're processed. Entries
+// pending for longer than the VisibilityTimeout are claimed, and redelivered;
+// unless they've already been delivered MaxDeliveries times, in which case
+// they're moved to the DeadLetterStream.
+//
+// Entries are delivered at least once: an entry whose Handler succeeds but
+// whose acknowledgement fails is redelivered, and one added to the
+// DeadLetterStream but not acknowledged is added again when it's next claimed.
+type Consumer struct {
+	w    *impl
+	opts ConsumerOptions
+}
+
+// NewConsumer returns a Consumer of the stream, which reads its entries once
+// Run.
+func (w *impl) NewConsumer(opts ConsumerOptions) (*Consumer, error) {
+	if empty(opts.Stream) {
+		return nil, errors.New("wredis: empty key")
+	}
+	if empty(opts.Group) {
+		return nil, errors.New("wredis: empty group")
+	}
+	if empty(opts.Name) {
+		return nil, errors.New("wredis: empty consumer")
+	}
+	if opts.Handler == nil {
+		return nil, errors.New("wredis: nil handler")
+	}
+	if opts.Count < 0 || opts.Block < 0 || opts.VisibilityTimeout < 0 || opts.MaxDeliveries < 0 {
+		return nil, errors.New("wredis: invalid consumer options")
+	}
+
+	if opts.Count == 0 {
+		opts.Count = 10
+	}
+	if opts.Block == 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.VisibilityTimeout == 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.DeadLetterStream == "" {
+		opts.DeadLetterStream = opts.Stream + ":dead"
+	}
+	return &Consumer{w: w, opts: opts}, nil
+}
+
+// Run creates the group (and stream) if they don't exist, then reads and
+// processes the entries until the context is done; returning nil, or the
+// error of any command which fails. Every half VisibilityTimeout, the idle
+// pending entries are claimed before reading new entries.
+func (c *Consumer) Run(ctx context.Context) error {
+	err := c.w.XGroupCreate(c.opts.Stream, c.opts.Group, c.opts.StartID, true)
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	var claimed time.Time
+	for ctx.Err() == nil {
+		if time.Since(claimed) >= c.opts.VisibilityTimeout/2 {
+			if err = c.claim(ctx); err != nil {
+				return c.stopped(ctx, err)
+			}
+			claimed = time.Now()
+		}
+
+		read, err := c.w.XReadGroup(c.opts.Group, c.opts.Name, map[string]string{c.opts.Stream: ">"},
+			XReadGroupOptions{Count: c.opts.Count, Block: c.opts.Block})
+		if err != nil {
+			return c.stopped(ctx, err)
+		}
+		for _, entry := range read[c.opts.Stream] {
+			if err = c.process(ctx, entry); err != nil {
+				return c.stopped(ctx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stopped returns nil if the context is done, as the error is expected
+func (c *Consumer) stopped(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// process passes the entry to the Handler, acknowledging it if it succeeds.
+// Entries which have been deleted are acknowledged without being processed.
+func (c *Consumer) process(ctx context.Context, entry StreamEntry) error {
+	if entry.Fields != nil {
+		if err := c.opts.Handler(ctx, entry); err != nil {
+			return nil
+		}
+	}
+	_, err := c.w.XAck(c.opts.Stream, c.opts.Group, entry.ID)
+	return err
+}
+
+// claim claims the entries pending for longer than the VisibilityTimeout,
+// moving those delivered more than MaxDeliveries times to the dead letters,
+// and processing the rest.
+func (c *Consumer) claim(ctx context.Context) error {
+	start := "0-0"
+	for ctx.Err() == nil {
+		next, entries, err := c.w.XAutoClaim(c.opts.Stream, c.opts.Group, c.opts.Name,
+			c.opts.VisibilityTimeout, start, c.opts.Count)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			var deliveries int64
+			if c.opts.MaxDeliveries > 0 {
+				if deliveries, err = c.deliveries(entry.ID); err != nil {
+					return err
+				}
+			}
+			if c.opts.MaxDeliveries > 0 && deliveries > c.opts.MaxDeliveries {
+				err = c.deadLetter(entry, deliveries)
+			} else {
+				err = c.process(ctx, entry)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == "0-0" || next == "" {
+			return nil
+		}
+		start = next
+	}
+	return nil
+}
+
+// deliveries returns the number of times the claimed entry has been delivered.
+// It's looked up by its ID alone, as a range of IDs could include other entries
+// pending for the consumer, which would use up the count.
+func (c *Consumer) deliveries(id string) (int64, error) {
+	pending, err := c.w.XPendingExt(c.opts.Stream, c.opts.Group, XPendingOptions{
+		Start: id,
+		End:   id,
+		Count: 1,
+	})
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	return pending[0].Deliveries, nil
+}
+
+// deadLetter adds the entry to the DeadLetterStream, along with its ID, stream
+// and deliveries, then acknowledges it. An entry which has been deleted is only
+// acknowledged. They're not sent in a transaction, as in Cluster mode the
+// streams may be in different slots.
+func (c *Consumer) deadLetter(entry StreamEntry, deliveries int64) error {
+	if entry.Fields != nil {
+		fields := make(map[string]string, len(entry.Fields)+3)
+		for field, value := range entry.Fields {
+			fields[field] = value
+		}
+		fields["orig_id"] = entry.ID
+		fields["stream"] = c.opts.Stream
+		fields["deliveries"] = strconv.FormatInt(deliveries, 10)
+		_, err := c.w.XAdd(c.opts.DeadLetterStream, fields, XAddOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.w.XAck(c.opts.Stream, c.opts.Group, entry.ID)
+	return err
+}
@@ -0,0 +1,267 @@
+package wredis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer Groups", func() {
+	testStream := "wredis::test::stream"
+	deadStream := "wredis::test::stream:dead"
+	group := "group"
+
+	BeforeEach(func() {
+		unsafe.Del(testStream, deadStream)
+	})
+
+	// add adds an entry to the stream, returning its ID
+	add := func(value string) string {
+		id, err := safe.XAdd(testStream, map[string]string{"v": value}, XAddOptions{})
+		Ω(err).ShouldNot(HaveOccurred())
+		return id
+	}
+
+	Context("commands", func() {
+		BeforeEach(func() {
+			Ω(safe.XGroupCreate(testStream, group, "0", true)).Should(Succeed())
+		})
+
+		It("should fail given an invalid group or consumer", func() {
+			Ω(safe.XGroupCreate(testStream, "", "0", true)).Should(MatchError("wredis: empty group"))
+			_, err := safe.XReadGroup(group, "", map[string]string{testStream: ""}, XReadGroupOptions{})
+			Ω(err).Should(MatchError("wredis: empty consumer"))
+			_, err = safe.XAck(testStream, group)
+			Ω(err).Should(MatchError("wredis: no ids"))
+			_, err = safe.XPendingExt(testStream, group, XPendingOptions{})
+			Ω(err).Should(MatchError("wredis: invalid count"))
+			_, err = safe.XClaim(testStream, group, "c", -time.Second, "1-1")
+			Ω(err).Should(MatchError("wredis: invalid min idle"))
+		})
+
+		It("should fail to create a group which exists", func() {
+			err := safe.XGroupCreate(testStream, group, "0", true)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(HavePrefix("BUSYGROUP"))
+		})
+
+		It("should read, and acknowledge, the entries of the group", func() {
+			a, b := add("a"), add("b")
+
+			read, err := safe.XReadGroup(group, "c1", map[string]string{testStream: ""}, XReadGroupOptions{Count: 1})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read[testStream]).Should(Equal([]StreamEntry{{ID: a, Fields: map[string]string{"v": "a"}}}))
+			read, err = safe.XReadGroup(group, "c2", map[string]string{testStream: ">"}, XReadGroupOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read[testStream]).Should(HaveLen(1))
+			Ω(read[testStream][0].ID).Should(Equal(b))
+
+			summary, err := safe.XPending(testStream, group)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary).Should(Equal(PendingSummary{
+				Count:     2,
+				Lowest:    a,
+				Highest:   b,
+				Consumers: map[string]int64{"c1": 1, "c2": 1},
+			}))
+
+			pending, err := safe.XPendingExt(testStream, group, XPendingOptions{Count: 10, Consumer: "c2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending[0].ID).Should(Equal(b))
+			Ω(pending[0].Consumer).Should(Equal("c2"))
+			Ω(pending[0].Deliveries).Should(BeEquivalentTo(1))
+
+			Ω(safe.XAck(testStream, group, a, b)).Should(BeEquivalentTo(2))
+			summary, err = safe.XPending(testStream, group)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.Count).Should(BeZero())
+		})
+
+		It("should return no streams once the block times out", func() {
+			read, err := safe.XReadGroup(group, "c1", map[string]string{testStream: ""},
+				XReadGroupOptions{Block: 20 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read).Should(BeEmpty())
+		})
+
+		It("should claim idle pending entries", func() {
+			a, b := add("a"), add("b")
+			_, err := safe.XReadGroup(group, "c1", map[string]string{testStream: ""}, XReadGroupOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			time.Sleep(20 * time.Millisecond)
+			entries, err := safe.XClaim(testStream, group, "c2", 10*time.Millisecond, a)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]StreamEntry{{ID: a, Fields: map[string]string{"v": "a"}}}))
+
+			next, entries, err := safe.XAutoClaim(testStream, group, "c3", 10*time.Millisecond, "", 10)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(next).Should(Equal("0-0"))
+			Ω(entries).Should(HaveLen(1))
+			Ω(entries[0].ID).Should(Equal(b))
+		})
+	})
+
+	Context("Consumer", func() {
+		It("should fail given invalid options", func() {
+			_, err := safe.NewConsumer(ConsumerOptions{Stream: testStream, Group: group, Name: "c"})
+			Ω(err).Should(MatchError("wredis: nil handler"))
+			_, err = safe.NewConsumer(ConsumerOptions{Stream: testStream, Name: "c"})
+			Ω(err).Should(MatchError("wredis: empty group"))
+		})
+
+		// run runs a Consumer with the handler until the context is done
+		run := func(ctx context.Context, opts ConsumerOptions) <-chan error {
+			opts.Stream, opts.Group, opts.Name = testStream, group, "c"
+			opts.StartID = "0"
+			opts.Block = 10 * time.Millisecond
+			c, err := safe.NewConsumer(opts)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Run(ctx)
+			}()
+			return done
+		}
+
+		It("should process and acknowledge the entries", func() {
+			var (
+				mu     sync.Mutex
+				values []string
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := run(ctx, ConsumerOptions{Handler: func(_ context.Context, e StreamEntry) error {
+				mu.Lock()
+				defer mu.Unlock()
+				values = append(values, e.Fields["v"])
+				return nil
+			}})
+			add("a")
+			add("b")
+
+			Eventually(func() []string {
+				mu.Lock()
+				defer mu.Unlock()
+				return append([]string(nil), values...)
+			}).Should(Equal([]string{"a", "b"}))
+			Eventually(func() (int64, error) {
+				summary, err := safe.XPending(testStream, group)
+				return summary.Count, err
+			}).Should(BeZero())
+
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("should redeliver entries which fail, once they're idle", func() {
+			var (
+				mu       sync.Mutex
+				attempts int
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			run(ctx, ConsumerOptions{
+				VisibilityTimeout: 50 * time.Millisecond,
+				Handler: func(context.Context, StreamEntry) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if attempts++; attempts == 1 {
+						return errors.New("failed")
+					}
+					return nil
+				},
+			})
+			add("a")
+
+			Eventually(func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return attempts
+			}).Should(Equal(2))
+			Eventually(func() (int64, error) {
+				summary, err := safe.XPending(testStream, group)
+				return summary.Count, err
+			}).Should(BeZero())
+		})
+
+		It("should move entries which exceed MaxDeliveries to the dead letters", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			run(ctx, ConsumerOptions{
+				VisibilityTimeout: 50 * time.Millisecond,
+				MaxDeliveries:     2,
+				Handler: func(context.Context, StreamEntry) error {
+					return errors.New("failed")
+				},
+			})
+			id := add("a")
+
+			Eventually(func() ([]StreamEntry, error) {
+				return safe.XRange(deadStream, "", "", 0)
+			}, 2*time.Second).Should(HaveLen(1))
+			dead, err := safe.XRange(deadStream, "", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dead[0].Fields).Should(Equal(map[string]string{
+				"v":          "a",
+				"orig_id":    id,
+				"stream":     testStream,
+				"deliveries": "3",
+			}))
+
+			summary, err := safe.XPending(testStream, group)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.Count).Should(BeZero())
+		})
+
+		It("should count the deliveries of each claimed entry", func() {
+			Ω(safe.XGroupCreate(testStream, group, "0", true)).Should(Succeed())
+			a, _, c := add("a"), add("b"), add("c")
+			_, err := safe.XReadGroup(group, "c", map[string]string{testStream: ">"}, XReadGroupOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			// a and c are idle and over-delivered, b pending between them isn't idle
+			_, err = safe.Do("XCLAIM", testStream, group, "c", 0, a, c, "IDLE", 60000, "RETRYCOUNT", 5)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var (
+				mu     sync.Mutex
+				values []string
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			run(ctx, ConsumerOptions{
+				VisibilityTimeout: time.Minute,
+				MaxDeliveries:     2,
+				Handler: func(_ context.Context, e StreamEntry) error {
+					mu.Lock()
+					defer mu.Unlock()
+					values = append(values, e.Fields["v"])
+					return nil
+				},
+			})
+
+			Eventually(func() ([]StreamEntry, error) {
+				return safe.XRange(deadStream, "", "", 0)
+			}).Should(HaveLen(2))
+			dead, err := safe.XRange(deadStream, "", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dead[0].Fields).Should(HaveKeyWithValue("orig_id", a))
+			Ω(dead[1].Fields).Should(HaveKeyWithValue("orig_id", c))
+			Ω(dead[1].Fields).Should(HaveKeyWithValue("v", "c"))
+
+			mu.Lock()
+			defer mu.Unlock()
+			Ω(values).Should(BeEmpty())
+			pending, err := safe.XPendingExt(testStream, group, XPendingOptions{Start: "-", End: "+", Count: 10})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+		})
+	})
+})
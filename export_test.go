@@ -0,0 +1,21 @@
+package wredis
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedigoDialer dials connections with redigo, rather than the native RESP
+// reader/writer, to compare the two in benchmarks.
+func RedigoDialer() Option {
+	return Dialer(func(cfg Config) dialFunc {
+		return func() (redis.Conn, error) {
+			return redis.Dial(cfg.Network, cfg.Addr(), redis.DialDatabase(int(cfg.DB)))
+		}
+	})
+}
+
+// GlobMatch matches a string against a glob-style pattern, like Redis' KEYS.
+var GlobMatch = globMatch
+
+// HashSlot returns the Redis Cluster hash slot of a key.
+var HashSlot = hashSlot
@@ -0,0 +1,187 @@
+package wredis_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeHandler returns the raw RESP reply for a command
+type fakeHandler func(args []string) string
+
+// fakeServer is a minimal RESP speaking server, used to test connection level
+// behaviour (TLS, AUTH, ...) which the shared test Redis isn't configured for.
+type fakeServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	cmds     [][]string
+	handlers map[string]fakeHandler
+}
+
+// newFakeServer starts a fakeServer on a random local port. If tlsCfg is not
+// nil the server will only accept TLS connections.
+func newFakeServer(tlsCfg *tls.Config) (*fakeServer, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+	if tlsCfg != nil {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsCfg)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return serveFake(ln), nil
+}
+
+// newFakeUnixServer starts a fakeServer listening on a unix socket at path
+func newFakeUnixServer(path string) (*fakeServer, error) {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return serveFake(ln), nil
+}
+
+// serveFake starts a fakeServer accepting connections from the listener
+func serveFake(ln net.Listener) *fakeServer {
+	s := &fakeServer{
+		ln:       ln,
+		handlers: make(map[string]fakeHandler),
+	}
+	go s.serve()
+	return s
+}
+
+// Addr returns the address the server is listening on
+func (s *fakeServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Port returns the port the server is listening on
+func (s *fakeServer) Port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Handle overrides the reply for some command
+func (s *fakeServer) Handle(cmd string, h fakeHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.ToUpper(cmd)] = h
+}
+
+// Commands returns all the commands received by the server
+func (s *fakeServer) Commands() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.cmds...)
+}
+
+// Close stops the server
+func (s *fakeServer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, s.reply(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) reply(args []string) string {
+	s.mu.Lock()
+	s.cmds = append(s.cmds, args)
+	h, ok := s.handlers[strings.ToUpper(args[0])]
+	s.mu.Unlock()
+	if ok {
+		return h(args)
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT", "SET":
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	case "ECHO":
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(args[1]), args[1])
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+// readFakeCommand reads a single RESP array of bulk strings
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readFakeHeader(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readFakeHeader(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readFakeHeader(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 || line[0] != prefix {
+		return 0, fmt.Errorf("fake: unexpected line %q", line)
+	}
+	return strconv.Atoi(strings.TrimSpace(line[1:]))
+}
+
+// fakeReply encodes the value as a RESP2 reply: strings as bulk strings, ints
+// as integers, and []interface{} as arrays.
+func fakeReply(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "*-1\r\n"
+	case int:
+		return fmt.Sprintf(":%d\r\n", v)
+	case string:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		reply := fmt.Sprintf("*%d\r\n", len(v))
+		for _, e := range v {
+			reply += fakeReply(e)
+		}
+		return reply
+	}
+	panic(fmt.Sprintf("fake: can't reply with %T", v))
+}
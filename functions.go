@@ -0,0 +1,216 @@
+package wredis
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// FunctionInfo describes a function of a library
+type FunctionInfo struct {
+	Name        string
+	Description string
+	Flags       []string
+}
+
+// LibraryInfo describes a library of functions, as returned by FunctionList
+type LibraryInfo struct {
+	Name      string
+	Engine    string
+	Functions []FunctionInfo
+	Code      string // only returned WithCode
+}
+
+// FunctionListOptions are the options of FunctionList
+type FunctionListOptions struct {
+	Pattern  string // only list the libraries whose names match the pattern
+	WithCode bool   // return the libraries' code
+}
+
+// FunctionLoad loads a library of functions, returning its name. Without
+// replace, loading a library which already exists fails.
+//
+// See: https://redis.io/commands/function-load
+func (w *impl) FunctionLoad(code string, replace bool) (string, error) {
+	if empty(code) {
+		return stringErr("wredis: empty code")
+	}
+	args := redis.Args{}.Add("LOAD")
+	if replace {
+		args = args.Add("REPLACE")
+	}
+	args = args.Add(code)
+	return w.String(func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("FUNCTION", args...))
+	})
+}
+
+// FunctionList returns the libraries of functions.
+//
+// See: https://redis.io/commands/function-list
+func (w *impl) FunctionList(opts FunctionListOptions) ([]LibraryInfo, error) {
+	args := redis.Args{}.Add("LIST")
+	if opts.Pattern != "" {
+		args = args.Add("LIBRARYNAME", opts.Pattern)
+	}
+	if opts.WithCode {
+		args = args.Add("WITHCODE")
+	}
+
+	var libs []LibraryInfo
+	err := w.with(func(conn redis.Conn) error {
+		replies, err := redis.Values(conn.Do("FUNCTION", args...))
+		if err != nil {
+			return err
+		}
+		libs = make([]LibraryInfo, len(replies))
+		for i, reply := range replies {
+			m, err := replyMap(reply, nil)
+			if err != nil {
+				return err
+			}
+			libs[i] = LibraryInfo{
+				Name:   mapString(m, "library_name"),
+				Engine: mapString(m, "engine"),
+				Code:   mapString(m, "library_code"),
+			}
+			if libs[i].Functions, err = functionInfos(m["functions"]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return libs, err
+}
+
+// functionInfos parses the functions of a library
+func functionInfos(reply interface{}) ([]FunctionInfo, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	functions := make([]FunctionInfo, len(values))
+	for i, v := range values {
+		m, err := replyMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		functions[i] = FunctionInfo{
+			Name:        mapString(m, "name"),
+			Description: mapString(m, "description"),
+		}
+		if m["flags"] != nil {
+			if functions[i].Flags, err = redis.Strings(m["flags"], nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return functions, nil
+}
+
+// FunctionDelete deletes a library, and all its functions. Like FlushAll, it
+// requires a Policy which allows `@dangerous` commands.
+//
+// See: https://redis.io/commands/function-delete
+func (w *impl) FunctionDelete(library string) error {
+	if w.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if !w.cfg.Policy.allows("FUNCTION", []interface{}{"DELETE"}) {
+		return unsafeErr("FunctionDelete")
+	}
+	if empty(library) {
+		return errors.New("wredis: empty library")
+	}
+	return w.ok("FunctionDelete", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("FUNCTION", "DELETE", library))
+	})
+}
+
+// FunctionFlush deletes all the libraries. Like FlushAll, it requires a
+// Policy which allows `@dangerous` commands.
+//
+// See: https://redis.io/commands/function-flush
+func (w *impl) FunctionFlush() error {
+	if w.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if !w.cfg.Policy.allows("FUNCTION", []interface{}{"FLUSH"}) {
+		return unsafeErr("FunctionFlush")
+	}
+	return w.ok("FunctionFlush", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("FUNCTION", "FLUSH"))
+	})
+}
+
+// FunctionDump returns a serialized payload of all the libraries, which can be
+// restored using FunctionRestore.
+//
+// See: https://redis.io/commands/function-dump
+func (w *impl) FunctionDump() ([]byte, error) {
+	var payload []byte
+	err := w.with(func(conn redis.Conn) (err error) {
+		payload, err = redis.Bytes(conn.Do("FUNCTION", "DUMP"))
+		return err
+	})
+	return payload, err
+}
+
+// FunctionRestore restores the libraries of a payload returned by
+// FunctionDump. The policy is one of "APPEND" (the default, if empty),
+// "REPLACE" or "FLUSH"; as FLUSH deletes the existing libraries, it requires a
+// Policy which allows `@dangerous` commands.
+//
+// See: https://redis.io/commands/function-restore
+func (w *impl) FunctionRestore(payload []byte, policy string) error {
+	if len(payload) == 0 {
+		return errors.New("wredis: empty payload")
+	}
+	args := redis.Args{}.Add("RESTORE", payload)
+	switch policy = strings.ToUpper(policy); policy {
+	case "":
+	case "APPEND", "REPLACE":
+		args = args.Add(policy)
+	case "FLUSH":
+		if w.cfg.ReadOnly {
+			return ErrReadOnly
+		}
+		if !w.cfg.Policy.allows("FUNCTION", []interface{}{"FLUSH"}) {
+			return unsafeErr("FunctionRestore")
+		}
+		args = args.Add(policy)
+	default:
+		return errors.New("wredis: invalid restore policy")
+	}
+	return w.ok("FunctionRestore", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("FUNCTION", args...))
+	})
+}
+
+// FCall calls a function, returning its reply.
+//
+// See: https://redis.io/commands/fcall
+func (w *impl) FCall(function string, keys []string, args ...interface{}) (interface{}, error) {
+	return w.fcall("FCALL", function, keys, args)
+}
+
+// FCallRO calls a read only function (one with the no-writes flag), returning
+// its reply. It's allowed by a ReadOnly Wredis. wredis has no read routing, so
+// it's sent to the configured server (the primary), not to a replica.
+//
+// See: https://redis.io/commands/fcall_ro
+func (w *impl) FCallRO(function string, keys []string, args ...interface{}) (interface{}, error) {
+	return w.fcall("FCALL_RO", function, keys, args)
+}
+
+// fcall calls the function with FCALL or FCALL_RO
+func (w *impl) fcall(cmd, function string, keys []string, args []interface{}) (interface{}, error) {
+	if empty(function) {
+		return nil, errors.New("wredis: empty function")
+	}
+	if any(keys, empty) {
+		return nil, errors.New("wredis: empty keys")
+	}
+	return w.Do(cmd, redis.Args{}.Add(function, len(keys)).AddFlat(keys).Add(args...)...)
+}
@@ -0,0 +1,126 @@
+package wredis_test
+
+import (
+	. "github.com/crowdriff/wredis"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Functions", func() {
+	var (
+		server *fakeServer
+		w      Wredis
+	)
+
+	// the miniredis test server doesn't implement functions, so they're faked
+	BeforeEach(func() {
+		var err error
+		server, err = newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		server.Handle("FUNCTION", func(args []string) string {
+			switch args[1] {
+			case "LOAD":
+				return "$5\r\nmylib\r\n"
+			case "LIST":
+				return "*1\r\n*8\r\n" +
+					"$12\r\nlibrary_name\r\n$5\r\nmylib\r\n" +
+					"$6\r\nengine\r\n$3\r\nLUA\r\n" +
+					"$9\r\nfunctions\r\n*1\r\n*6\r\n" +
+					"$4\r\nname\r\n$3\r\nget\r\n" +
+					"$11\r\ndescription\r\n$-1\r\n" +
+					"$5\r\nflags\r\n*1\r\n$9\r\nno-writes\r\n" +
+					"$12\r\nlibrary_code\r\n$4\r\ncode\r\n"
+			case "DUMP":
+				return "$7\r\npayload\r\n"
+			}
+			return "+OK\r\n"
+		})
+		server.Handle("FCALL", func(args []string) string { return ":1\r\n" })
+		server.Handle("FCALL_RO", func(args []string) string { return "$5\r\nvalue\r\n" })
+
+		w, err = Safe(Host("127.0.0.1"), Port(server.Port()))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		w.Close()
+		server.Close()
+	})
+
+	// sent returns the last command the server received
+	sent := func() []string {
+		cmds := server.Commands()
+		return cmds[len(cmds)-1]
+	}
+
+	It("should load a library", func() {
+		_, err := w.FunctionLoad("", false)
+		Ω(err).Should(MatchError("wredis: empty code"))
+
+		Ω(w.FunctionLoad("#!lua name=mylib", true)).Should(Equal("mylib"))
+		Ω(sent()).Should(Equal([]string{"FUNCTION", "LOAD", "REPLACE", "#!lua name=mylib"}))
+	})
+
+	It("should list the libraries", func() {
+		libs, err := w.FunctionList(FunctionListOptions{Pattern: "my*", WithCode: true})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sent()).Should(Equal([]string{"FUNCTION", "LIST", "LIBRARYNAME", "my*", "WITHCODE"}))
+		Ω(libs).Should(Equal([]LibraryInfo{{
+			Name:      "mylib",
+			Engine:    "LUA",
+			Functions: []FunctionInfo{{Name: "get", Flags: []string{"no-writes"}}},
+			Code:      "code",
+		}}))
+	})
+
+	It("should only delete or flush the libraries with an unsafe Wredis", func() {
+		Ω(w.FunctionDelete("mylib")).Should(MatchError("wredis: FunctionDelete requires unsafe impl. See wredis.Unsafe"))
+		Ω(w.FunctionFlush()).Should(MatchError("wredis: FunctionFlush requires unsafe impl. See wredis.Unsafe"))
+
+		u, err := Unsafe(Host("127.0.0.1"), Port(server.Port()))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer u.Close()
+		Ω(u.FunctionDelete("")).Should(MatchError("wredis: empty library"))
+		Ω(u.FunctionDelete("mylib")).Should(Succeed())
+		Ω(sent()).Should(Equal([]string{"FUNCTION", "DELETE", "mylib"}))
+		Ω(u.FunctionFlush()).Should(Succeed())
+		Ω(sent()).Should(Equal([]string{"FUNCTION", "FLUSH"}))
+	})
+
+	It("should dump and restore the libraries", func() {
+		payload, err := w.FunctionDump()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(payload).Should(Equal([]byte("payload")))
+
+		Ω(w.FunctionRestore(nil, "")).Should(MatchError("wredis: empty payload"))
+		Ω(w.FunctionRestore(payload, "merge")).Should(MatchError("wredis: invalid restore policy"))
+		Ω(w.FunctionRestore(payload, "flush")).Should(MatchError("wredis: FunctionRestore requires unsafe impl. See wredis.Unsafe"))
+		Ω(w.FunctionRestore(payload, "replace")).Should(Succeed())
+		Ω(sent()).Should(Equal([]string{"FUNCTION", "RESTORE", "payload", "REPLACE"}))
+	})
+
+	It("should call functions", func() {
+		_, err := w.FCall("", nil)
+		Ω(err).Should(MatchError("wredis: empty function"))
+
+		Ω(redis.Int(w.FCall("incr", []string{"a", "b"}, 1))).Should(Equal(1))
+		Ω(sent()).Should(Equal([]string{"FCALL", "incr", "2", "a", "b", "1"}))
+		Ω(redis.String(w.FCallRO("get", []string{"a"}))).Should(Equal("value"))
+		Ω(sent()).Should(Equal([]string{"FCALL_RO", "get", "1", "a"}))
+	})
+
+	It("should only call read only functions when ReadOnly", func() {
+		r, err := Unsafe(Host("127.0.0.1"), Port(server.Port()), ReadOnly(true))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer r.Close()
+
+		_, err = r.FCall("incr", []string{"a"})
+		Ω(err).Should(Equal(ErrReadOnly))
+		_, err = r.FunctionLoad("#!lua name=mylib", false)
+		Ω(err).Should(Equal(ErrReadOnly))
+		Ω(r.FunctionDelete("mylib")).Should(Equal(ErrReadOnly))
+		Ω(redis.String(r.FCallRO("get", []string{"a"}))).Should(Equal("value"))
+	})
+})
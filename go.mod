@@ -1,9 +1,11 @@
 module github.com/crowdriff/wredis
 
-go 1.15
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/garyburd/redigo v1.6.2
 	github.com/onsi/ginkgo v1.15.0
 	github.com/onsi/gomega v1.10.5
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,125 @@
+package wredis
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// PingOnBorrow returns a TestOnBorrower which PINGs connections that have been
+// idle in the pool for at least minIdle before they're borrowed. Connections
+// which fail the PING are closed, and another is borrowed (or dialed) instead.
+//
+// See: TestOnBorrower
+func PingOnBorrow(minIdle time.Duration) func(Config) borrowFunc {
+	return func(Config) borrowFunc {
+		return func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < minIdle {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		}
+	}
+}
+
+// Health is the result of a health check
+type Health struct {
+	Status  string     `json:"status"` // "ok" if Redis responded to PING, otherwise "error"
+	Error   string     `json:"error,omitempty"`
+	Latency float64    `json:"latency_ms"` // the PING round trip, in milliseconds
+	Pool    HealthPool `json:"pool"`
+	Breaker string     `json:"breaker"`
+	Role    string     `json:"role,omitempty"`    // from INFO, e.g. "master"
+	Version string     `json:"version,omitempty"` // from INFO, e.g. "7.2.4"
+}
+
+// HealthPool are the pool statistics of a health check
+type HealthPool struct {
+	Active int `json:"active"`
+	Idle   int `json:"idle"`
+}
+
+// HealthCheck PINGs Redis, and gets its role & version using INFO. A failed
+// PING is reported as an "error" Status; but if only INFO fails, the Role and
+// Version are left empty.
+func HealthCheck(w Wredis) Health {
+	health := Health{Status: "ok"}
+
+	start := time.Now()
+	if _, err := w.Ping(); err != nil {
+		health.Status = "error"
+		health.Error = err.Error()
+	} else {
+		health.Latency = milliseconds(time.Since(start))
+		health.Role, health.Version = serverInfo(w)
+	}
+
+	stats := w.Stats()
+	health.Pool = HealthPool{
+		Active: stats.Stats.ActiveCount,
+		Idle:   stats.Stats.IdleCount,
+	}
+	health.Breaker = stats.Breaker.String()
+	return health
+}
+
+// serverInfo returns the server's role & version from INFO, or empty strings
+// if INFO fails
+func serverInfo(w Wredis) (role, version string) {
+	for _, section := range []string{"server", "replication"} {
+		info, err := w.String(func(conn redis.Conn) (string, error) {
+			return redis.String(conn.Do("INFO", section))
+		})
+		if err != nil {
+			break
+		}
+		fields := parseInfo(info)
+		if v, ok := fields["redis_version"]; ok {
+			version = v
+		}
+		if v, ok := fields["role"]; ok {
+			role = v
+		}
+	}
+	return role, version
+}
+
+// HealthHandler returns an http.Handler which responds with the JSON encoded
+// HealthCheck; with a 200 status when healthy, otherwise a 503. It's suitable
+// for use as a readiness probe.
+func HealthHandler(w Wredis) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		health := HealthCheck(w)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-store")
+		if health.Status != "ok" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(health)
+	})
+}
+
+// parseInfo parses the "field:value" lines of an INFO reply
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+// milliseconds returns the duration in fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,126 @@
+package wredis_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		server *fakeServer
+		w      Wredis
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		server.Handle("INFO", func(args []string) string {
+			info := map[string]string{
+				"server":      "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n",
+				"replication": "# Replication\r\nrole:master\r\nconnected_slaves:0\r\n",
+			}[args[1]]
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)
+		})
+	})
+
+	AfterEach(func() {
+		Ω(w.Close()).Should(Succeed())
+		server.Close()
+	})
+
+	Context("PingOnBorrow", func() {
+		pings := func() int {
+			n := 0
+			for _, cmd := range server.Commands() {
+				if cmd[0] == "PING" {
+					n++
+				}
+			}
+			return n
+		}
+
+		It("should PING idle connections when borrowed", func() {
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), TestOnBorrower(PingOnBorrow(0)))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(w.Set("key", "value")).Should(Succeed())
+			Ω(w.Set("key", "value")).Should(Succeed())
+			Ω(pings()).Should(Equal(1))
+		})
+
+		It("should not PING recently used connections", func() {
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), TestOnBorrower(PingOnBorrow(time.Minute)))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(w.Set("key", "value")).Should(Succeed())
+			Ω(w.Set("key", "value")).Should(Succeed())
+			Ω(pings()).Should(Equal(0))
+		})
+	})
+
+	Context("HealthHandler", func() {
+		get := func() (*httptest.ResponseRecorder, Health) {
+			rec := httptest.NewRecorder()
+			HealthHandler(w).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			var health Health
+			Ω(json.Unmarshal(rec.Body.Bytes(), &health)).Should(Succeed())
+			return rec, health
+		}
+
+		It("should report a healthy server", func() {
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			rec, health := get()
+			Ω(rec.Code).Should(Equal(http.StatusOK))
+			Ω(rec.Header().Get("Content-Type")).Should(Equal("application/json"))
+			Ω(health.Status).Should(Equal("ok"))
+			Ω(health.Error).Should(BeEmpty())
+			Ω(health.Latency).Should(BeNumerically(">", 0))
+			Ω(health.Role).Should(Equal("master"))
+			Ω(health.Version).Should(Equal("7.2.4"))
+			Ω(health.Breaker).Should(Equal("closed"))
+			Ω(health.Pool.Idle).Should(Equal(1))
+		})
+
+		It("should report an unavailable server", func() {
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()))
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Close()
+
+			rec, health := get()
+			Ω(rec.Code).Should(Equal(http.StatusServiceUnavailable))
+			Ω(health.Status).Should(Equal("error"))
+			Ω(health.Error).ShouldNot(BeEmpty())
+		})
+
+		It("should report a healthy server without INFO", func() {
+			server.Handle("INFO", func([]string) string {
+				return "-ERR unknown command 'INFO'\r\n"
+			})
+
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			rec, health := get()
+			Ω(rec.Code).Should(Equal(http.StatusOK))
+			Ω(health.Role).Should(BeEmpty())
+			Ω(health.Version).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,60 @@
+package wredis
+
+import (
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// PFAdd adds the elements to the HyperLogLog at key, creating it if it doesn't
+// exist; returning true if its approximated cardinality changed.
+//
+// See: https://redis.io/commands/pfadd
+func (w *impl) PFAdd(key string, elements ...string) (bool, error) {
+	if empty(key) {
+		return boolErr("wredis: empty key")
+	}
+	return w.Bool(func(conn redis.Conn) (bool, error) {
+		return redis.Bool(conn.Do("PFADD", redis.Args{}.Add(key).AddFlat(elements)...))
+	})
+}
+
+// PFCount returns the approximated cardinality of the HyperLogLog at key, or
+// of the union of the HyperLogLogs at multiple keys. In Cluster mode, the keys
+// must all be in the same slot.
+//
+// See: https://redis.io/commands/pfcount
+func (w *impl) PFCount(keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return int64Err("wredis: no keys")
+	}
+	if any(keys, empty) {
+		return int64Err("wredis: empty keys")
+	}
+	if w.cfg.Cluster && !w.sameSlot(keys...) {
+		return int64Err("wredis: keys in different slots")
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("PFCOUNT", redis.Args{}.AddFlat(keys)...))
+	})
+}
+
+// PFMerge merges the HyperLogLogs at the keys into the one at dest, creating
+// it if it doesn't exist. In Cluster mode, dest and the keys must all be in the
+// same slot.
+//
+// See: https://redis.io/commands/pfmerge
+func (w *impl) PFMerge(dest string, keys ...string) error {
+	if empty(dest) {
+		return errors.New("wredis: empty dest")
+	}
+	if any(keys, empty) {
+		return errors.New("wredis: empty keys")
+	}
+	if w.cfg.Cluster && !w.sameSlot(append([]string{dest}, keys...)...) {
+		return errors.New("wredis: keys in different slots")
+	}
+	return w.ok("PFMerge", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("PFMERGE", redis.Args{}.Add(dest).AddFlat(keys)...))
+	})
+}
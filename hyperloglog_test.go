@@ -0,0 +1,90 @@
+package wredis_test
+
+import (
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HyperLogLog", func() {
+	testKey := "wredis::test::hll"
+	otherKey := "wredis::test::hll2"
+	dstKey := "wredis::test::hll::dst"
+
+	BeforeEach(func() {
+		unsafe.Del(testKey, otherKey, dstKey)
+	})
+
+	It("should fail given empty keys", func() {
+		_, err := safe.PFAdd("", "a")
+		Ω(err).Should(MatchError("wredis: empty key"))
+		_, err = safe.PFCount()
+		Ω(err).Should(MatchError("wredis: no keys"))
+		_, err = safe.PFCount(testKey, "")
+		Ω(err).Should(MatchError("wredis: empty keys"))
+		Ω(safe.PFMerge("", testKey)).Should(MatchError("wredis: empty dest"))
+		Ω(safe.PFMerge(dstKey, " ")).Should(MatchError("wredis: empty keys"))
+	})
+
+	It("should count the unique elements", func() {
+		Ω(safe.PFAdd(testKey, "a", "b", "c")).Should(BeTrue())
+		Ω(safe.PFAdd(testKey, "a", "b")).Should(BeFalse())
+		Ω(safe.PFCount(testKey)).Should(BeEquivalentTo(3))
+		Ω(safe.PFCount(otherKey)).Should(BeZero())
+	})
+
+	It("should count, and merge, the union of HyperLogLogs", func() {
+		Ω(safe.PFAdd(testKey, "a", "b", "c")).Should(BeTrue())
+		Ω(safe.PFAdd(otherKey, "c", "d")).Should(BeTrue())
+		// the miniredis test server sums, rather than unions, the counts
+		Ω(safe.PFCount(testKey, otherKey)).Should(BeNumerically(">=", 4))
+
+		Ω(safe.PFMerge(dstKey, testKey, otherKey)).Should(Succeed())
+		Ω(safe.PFCount(dstKey)).Should(BeEquivalentTo(4))
+	})
+
+	Context("in Cluster mode", func() {
+		var (
+			server *fakeServer
+			w      Wredis
+		)
+
+		BeforeEach(func() {
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("PFCOUNT", func([]string) string { return ":2\r\n" })
+			server.Handle("PFMERGE", func([]string) string { return "+OK\r\n" })
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), Cluster(true))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			w.Close()
+			server.Close()
+		})
+
+		It("should fail for keys in different slots", func() {
+			// "foo" is in slot 12182, and "bar" in 5061
+			_, err := w.PFCount("foo", "bar")
+			Ω(err).Should(MatchError("wredis: keys in different slots"))
+			Ω(w.PFMerge("foo", "bar")).Should(MatchError("wredis: keys in different slots"))
+			Ω(server.Commands()).ShouldNot(ContainElement(ContainElement("PFCOUNT")))
+			Ω(server.Commands()).ShouldNot(ContainElement(ContainElement("PFMERGE")))
+		})
+
+		It("should send keys in the same slot", func() {
+			Ω(w.PFCount("{visits}:mon", "{visits}:tue")).Should(BeEquivalentTo(2))
+			Ω(w.PFMerge("{visits}:week", "{visits}:mon", "{visits}:tue")).Should(Succeed())
+			Ω(server.Commands()).Should(ContainElement([]string{"PFCOUNT", "{visits}:mon", "{visits}:tue"}))
+		})
+
+		It("should hash the keys with their KeyPrefix", func() {
+			p, err := Safe(Host("127.0.0.1"), Port(server.Port()), Cluster(true), KeyPrefix("{visits}:"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer p.Close()
+			Ω(p.PFCount("foo", "bar")).Should(BeEquivalentTo(2))
+		})
+	})
+})
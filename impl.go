@@ -1,9 +1,12 @@
 package wredis
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -20,9 +23,24 @@ var (
 //
 // See: http://redis.io/commands
 type impl struct {
-	cfg    Config      // Config this was intialised with
-	pool   *redis.Pool // the underlying redis connection pool
-	unsafe bool        // safe impl?
+	retries    int64  // count of retried attempts, first for atomic alignment
+	generation uint64 // generation of our DB when Select'd, see generations
+	closing    int32  // set once Shutdown is called
+
+	cfg       Config          // Config this was intialised with
+	pool      *redis.Pool     // the underlying redis connection pool
+	pipelines *pipelines      // auto pipelining connections, if enabled
+	breaker   *breaker        // circuit breaker, if enabled
+	parent    *impl           // the Wredis this was Select'd from, if any
+	swaps     *generations    // DB generations, shared with our parent
+	server    *serverCommands // commands classified by the server, if read only
+	slots     *clusterSlots   // the cluster's slots and nodes, in Cluster mode
+
+	dbsMu sync.Mutex
+	dbs   map[uint]*impl // the Wredis' opened by Select, nil once closed
+
+	subsMu sync.Mutex
+	subs   map[*Subscription]struct{} // open Subscriptions, nil once closed
 
 	mu     sync.RWMutex
 	counts map[string]int // command counts
@@ -31,7 +49,7 @@ type impl struct {
 // get the command counts
 func (w *impl) stats() CMDCounts {
 	w.mu.RLock()
-	defer w.mu.Unlock()
+	defer w.mu.RUnlock()
 
 	counts := make(CMDCounts, len(w.counts))
 	for k, v := range w.counts {
@@ -47,26 +65,162 @@ func (w *impl) inc(cmd string) {
 	w.counts[cmd]++
 }
 
-// Close will close the *redis.Pool
+// ErrClosed is returned for commands sent once Shutdown has been called
+var ErrClosed = errors.New("wredis: closed")
+
+// Shutdown gracefully closes the Wredis. It stops handing out connections, so
+// any new commands fail with ErrClosed, and waits for the commands in flight
+// to complete before calling Close. If the context is done first, Close is
+// called regardless and the context's error is returned.
+//
+// As with Close, calling Shutdown on a Wredis returned by Select does nothing;
+// it is shut down along with the Wredis it was selected from.
+func (w *impl) Shutdown(ctx context.Context) error {
+	if w.parent != nil {
+		return nil
+	}
+
+	impls := append(w.children(), w)
+	for _, impl := range impls {
+		atomic.StoreInt32(&impl.closing, 1)
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if !inUse(impls) {
+			return w.Close()
+		}
+		select {
+		case <-ctx.Done():
+			w.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// inUse returns true if any of the pools have connections in use
+func inUse(impls []*impl) bool {
+	for _, impl := range impls {
+		// ActiveCount includes the idle connections
+		stats := impl.pool.Stats()
+		if stats.ActiveCount != stats.IdleCount {
+			return true
+		}
+	}
+	return false
+}
+
+// children returns the Wredis' opened by Select
+func (w *impl) children() []*impl {
+	w.dbsMu.Lock()
+	defer w.dbsMu.Unlock()
+	children := make([]*impl, 0, len(w.dbs))
+	for _, child := range w.dbs {
+		children = append(children, child)
+	}
+	return children
+}
+
+// Close will close the *redis.Pool, any auto pipelining connections, and the
+// Wredis' opened by Select. Calling Close on a Wredis returned by Select does
+// nothing, it is closed along with the Wredis it was selected from.
 func (w *impl) Close() error {
+	if w.parent != nil {
+		return nil
+	}
+	return w.close()
+}
+
+// close closes the Wredis, and its children
+func (w *impl) close() error {
+	w.dbsMu.Lock()
+	children := w.dbs
+	w.dbs = nil
+	w.dbsMu.Unlock()
+	for _, child := range children {
+		child.close()
+	}
+	w.closeSubscriptions()
+	if w.slots != nil {
+		w.slots.close()
+	}
+
+	if w.pipelines != nil {
+		w.pipelines.Close()
+	}
 	return w.pool.Close()
 }
 
-// Conn returns a redis.Conn from the underlying pool
+// Conn returns a redis.Conn from the underlying pool; or with auto pipelining,
+// a redis.Conn which pipelines commands where possible. With a RetryPolicy the
+// redis.Conn retries commands, and only connects once a command is sent.
 func (w *impl) Conn() (redis.Conn, error) {
-	// get a connection from the pool
-	conn := w.pool.Get()
+	if w.cfg.RetryPolicy.retries() {
+		return w.wrap(&retryConn{w: w}), nil
+	}
+	conn := w.conn()
 	// check the connection was established without error
 	if err := conn.Err(); err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return conn, nil
+	return w.wrap(conn), nil
+}
+
+// wrap wraps the redis.Conn to prefix keys, if there's a KeyPrefix, and to
+// check commands against the Policy
+func (w *impl) wrap(conn redis.Conn) redis.Conn {
+	if w.cfg.KeyPrefix != "" {
+		conn = &prefixConn{Conn: conn, w: w, prefix: w.cfg.KeyPrefix}
+	}
+	return &policyConn{Conn: conn, w: w}
+}
+
+// conn returns a redis.Conn from the pool, or an auto pipelining redis.Conn.
+// With a circuit breaker, the redis.Conn fails with ErrCircuitOpen while it's
+// open; otherwise the connection's failure (or not) is recorded when closed.
+func (w *impl) conn() redis.Conn {
+	if atomic.LoadInt32(&w.closing) == 1 {
+		return errorConn{ErrClosed}
+	}
+	if w.swapped() {
+		return errorConn{ErrDBSwapped}
+	}
+	if w.breaker != nil {
+		if err := w.breaker.allow(); err != nil {
+			return errorConn{err}
+		}
+	}
+
+	var conn redis.Conn
+	if w.pipelines != nil {
+		conn = &pipelineConn{w: w}
+	} else {
+		conn = w.pool.Get()
+	}
+
+	if w.breaker != nil {
+		return &breakerConn{Conn: conn, b: w.breaker}
+	}
+	return conn
+}
+
+// probe PINGs the server using a new connection from the pool
+func (w *impl) probe() error {
+	conn := w.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	return err
 }
 
 // Stats contains impl statistics.
 type Stats struct {
-	Stats  redis.PoolStats
-	Counts CMDCounts
+	Stats   redis.PoolStats
+	Counts  CMDCounts
+	Retries int64        // attempts retried by the RetryPolicy
+	Breaker BreakerState // the circuit breaker's state, closed if disabled
 }
 
 // CMDCounts is a simple wrapper around map[string]int
@@ -82,13 +236,15 @@ func (cc CMDCounts) Count(cmd string) int {
 
 // Stats returns the current statstics.
 func (w *impl) Stats() Stats {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	return Stats{
-		Stats:  w.pool.Stats(),
-		Counts: w.stats(),
+	stats := Stats{
+		Stats:   w.pool.Stats(),
+		Counts:  w.stats(),
+		Retries: atomic.LoadInt64(&w.retries),
+	}
+	if w.breaker != nil {
+		stats.Breaker = w.breaker.State()
 	}
+	return stats
 }
 
 var nilErr error = nil
@@ -102,18 +258,65 @@ func newPoolClient(cfg Config) (*impl, error) {
 		MaxIdle:         cfg.MaxIdle,
 		IdleTimeout:     time.Duration(cfg.IdleTimeout),
 		Dial:            cfg.Dialer(cfg),
-		TestOnBorrow:    cfg.TestOnBorrower(cfg),
+		TestOnBorrow:    cfg.testOnBorrow(),
 		Wait:            cfg.Wait,
 	}
 
-	return &impl{
+	w := &impl{
 		cfg:    cfg,
 		pool:   pool,
 		counts: make(map[string]int),
-	}, nil
+		dbs:    make(map[uint]*impl),
+		subs:   make(map[*Subscription]struct{}),
+		swaps:  newGenerations(),
+		server: newServerCommands(),
+	}
+	if cfg.Cluster {
+		w.slots = newClusterSlots()
+	}
+	if cfg.AutoPipeline > 0 {
+		w.pipelines = newPipelines(cfg)
+	}
+	if cfg.BreakerPolicy.enabled() {
+		w.breaker = newBreaker(cfg.BreakerPolicy, w.probe)
+	}
+	if err := w.warmup(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
 }
 
-// Safe returns a "safe" *impl impl configured with the provided options.
+// warmup dials the configured MinIdle connections, returning them to the pool.
+// It only fails if none of them could be dialed.
+func (w *impl) warmup() error {
+	if w.cfg.MinIdle == 0 {
+		return nil
+	}
+
+	conns := make([]redis.Conn, w.cfg.MinIdle)
+	for i := range conns {
+		conns[i] = w.pool.Get()
+	}
+
+	var err error
+	dialed := 0
+	for _, conn := range conns {
+		if e := conn.Err(); e != nil {
+			err = e
+		} else {
+			dialed++
+		}
+		conn.Close()
+	}
+	if dialed == 0 {
+		return err
+	}
+	return nil
+}
+
+// Safe returns a "safe" *impl impl configured with the provided options. It
+// uses the SafePolicy, unless another is set using CommandPolicy.
 func Safe(opts ...Option) (Wredis, error) {
 	cfg, err := newConfig(opts...)
 	if err != nil {
@@ -124,18 +327,14 @@ func Safe(opts ...Option) (Wredis, error) {
 
 // Unsafe returns an "unsafe" *impl impl configured with the provided
 // options. The "unsafe"ness allows usage of certain methods that could be
-// harmful if accidentally invoked in a production environment (e.g. FlushAll)
+// harmful if accidentally invoked in a production environment (e.g. FlushAll);
+// as it uses the UnsafePolicy, unless another is set using CommandPolicy.
 func Unsafe(opts ...Option) (Wredis, error) {
-	cfg, err := newConfig(opts...)
+	cfg, err := newConfig(append([]Option{CommandPolicy(UnsafePolicy())}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
-	w, err := newPoolClient(cfg)
-	if err != nil {
-		return nil, err
-	}
-	w.unsafe = true
-	return w, nil
+	return newPoolClient(cfg)
 }
 
 // ok is a convenience method for checking if we received the OK simple string
@@ -155,7 +354,7 @@ const matchErrFmt = `wredis: %s expected "%s" response, got: "%s"`
 func (w *impl) match(cmd, m string, f stringFunc) (string, error) {
 	res, err := w.String(f)
 	if err != nil {
-		return stringErr(err.Error())
+		return "", err
 	}
 
 	if res != m {
@@ -179,12 +378,23 @@ func Close(conn redis.Conn) error {
 	return conn.Close()
 }
 
+// call executes a command over a redis.Conn, reading the reply into the call.
+// It should only be used with native connections, see Config.native.
+func (w *impl) call(cmd string, call *respCall) error {
+	conn, err := w.Conn()
+	if err != nil {
+		return err
+	}
+	defer Close(conn)
+	return doCall(conn, cmd, call)
+}
+
 // Bool is a helper function to execute any series of commands over a
 // redis.Conn that returns a bool response.
 func (w *impl) Bool(f boolFunc) (bool, error) {
 	conn, err := w.Conn()
 	if err != nil {
-		return boolErr(err.Error())
+		return false, err
 	}
 	defer Close(conn)
 	return f(conn)
@@ -195,7 +405,7 @@ func (w *impl) Bool(f boolFunc) (bool, error) {
 func (w *impl) Int(f intFunc) (int, error) {
 	conn, err := w.Conn()
 	if err != nil {
-		return intErr(err.Error())
+		return 0, err
 	}
 	defer Close(conn)
 	return f(conn)
@@ -206,7 +416,7 @@ func (w *impl) Int(f intFunc) (int, error) {
 func (w *impl) Int64(f int64Func) (int64, error) {
 	conn, err := w.Conn()
 	if err != nil {
-		return int64Err(err.Error())
+		return 0, err
 	}
 	defer Close(conn)
 	return f(conn)
@@ -217,7 +427,7 @@ func (w *impl) Int64(f int64Func) (int64, error) {
 func (w *impl) String(f stringFunc) (string, error) {
 	conn, err := w.Conn()
 	if err != nil {
-		return stringErr(err.Error())
+		return "", err
 	}
 	defer Close(conn)
 	return f(conn)
@@ -228,8 +438,30 @@ func (w *impl) String(f stringFunc) (string, error) {
 func (w *impl) Strings(f stringsFunc) ([]string, error) {
 	conn, err := w.Conn()
 	if err != nil {
-		return stringsErr(err.Error())
+		return nil, err
+	}
+	defer Close(conn)
+	return f(conn)
+}
+
+// with is a helper function to execute any series of commands over a
+// redis.Conn, whose results are captured by f.
+func (w *impl) with(f func(redis.Conn) error) error {
+	conn, err := w.Conn()
+	if err != nil {
+		return err
 	}
 	defer Close(conn)
 	return f(conn)
 }
+
+// Do sends a command to Redis, returning the reply. It's checked against the
+// Policy like any other command.
+func (w *impl) Do(cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := w.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer Close(conn)
+	return conn.Do(cmd, args...)
+}
@@ -7,6 +7,41 @@ import (
 	"github.com/garyburd/redigo/redis"
 )
 
+// CopyOptions are the options of Copy
+type CopyOptions struct {
+	DB      *uint // the DB to copy to, rather than the configured DB
+	Replace bool  // replace the destination key, if it exists
+}
+
+// Copy copies the value of "src" to "dst". If the destination key exists, and
+// Replace isn't set, then `false, nil` is returned. On success, `true, nil` is
+// returned.
+//
+// See: https://redis.io/commands/copy
+func (w *impl) Copy(src, dst string, opts CopyOptions) (bool, error) {
+	if empty(src) {
+		return boolErr("wredis: empty src")
+	}
+	if empty(dst) {
+		return boolErr("wredis: empty dst")
+	}
+	args := redis.Args{}.Add(src, dst)
+	if opts.DB != nil {
+		if w.cfg.Cluster && *opts.DB != 0 {
+			return boolErr("wredis: cluster supports db/0 only")
+		}
+		args = args.Add("DB", *opts.DB)
+	} else if src == dst {
+		return boolErr("wredis: src == dst")
+	}
+	if opts.Replace {
+		args = args.Add("REPLACE")
+	}
+	return w.Bool(func(conn redis.Conn) (bool, error) {
+		return redis.Bool(conn.Do("COPY", args...))
+	})
+}
+
 // Del deletes one or more keys from Redis and returns a count of how many keys
 // were actually deleted.
 //
@@ -30,12 +65,17 @@ func (w *impl) Delete(keys ...string) (int64, error) {
 }
 
 // DelPattern is a convenience method that Deletes *all* keys matching the
-// provided pattern.
+// provided pattern. As it can delete any number of keys, the Policy must allow
+// "@dangerous" commands; and the keys are deleted in batches of at most the
+// Policy's MaxDelKeys.
 //
 // See: http://redis.io/commands/keys
 // See: http://redis.io/commands/del
 func (w *impl) DelPattern(pattern string) (int64, error) {
-	if !w.unsafe {
+	if w.cfg.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	if !w.cfg.Policy.allowsCategory("@dangerous") {
 		return int64Err(unsafeErr("DelPattern").Error())
 	}
 	if strings.TrimSpace(pattern) == "" {
@@ -44,12 +84,26 @@ func (w *impl) DelPattern(pattern string) (int64, error) {
 	// fetch & delete keys
 	keys, err := w.Keys(pattern)
 	if err != nil {
-		return int64Err(err.Error())
+		return 0, err
 	}
-	if len(keys) == 0 {
-		return 0, nil
+	batch := len(keys)
+	if max := w.cfg.Policy.MaxDelKeys; max > 0 && max < batch {
+		batch = max
 	}
-	return w.Del(keys...)
+	var deleted int64
+	for len(keys) > 0 {
+		n := batch
+		if n > len(keys) {
+			n = len(keys)
+		}
+		count, err := w.Del(keys[:n]...)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+		keys = keys[n:]
+	}
+	return deleted, nil
 }
 
 // Exists checks for the existence of `key` in Redis. Note however, even though
@@ -93,6 +147,66 @@ func (w *impl) Keys(pattern string) ([]string, error) {
 	})
 }
 
+// Scan incrementally iterates over the keys, returning the next cursor and the
+// keys matching the pattern (or any key, if it's empty). Start with a cursor of
+// 0, and stop once it's returned again; count is a hint of how many keys to
+// return, 0 uses Redis' default.
+//
+// See: https://redis.io/commands/scan
+func (w *impl) Scan(cursor uint64, pattern string, count int) (uint64, []string, error) {
+	if count < 0 {
+		return 0, nil, errors.New("wredis: invalid count")
+	}
+	args := redis.Args{}.Add(cursor)
+	if pattern != "" {
+		args = args.Add("MATCH", pattern)
+	}
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+
+	conn, err := w.Conn()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer Close(conn)
+	reply, err := redis.Values(conn.Do("SCAN", args...))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(reply) != 2 {
+		return 0, nil, errors.New("wredis: invalid scan reply")
+	}
+	next, err := redis.Uint64(reply[0], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	keys, err := redis.Strings(reply[1], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return next, keys, nil
+}
+
+// Move moves "key" to the DB. If the key doesn't exist, or already exists in
+// the DB, then `false, nil` is returned. On success, `true, nil` is returned.
+//
+// See: https://redis.io/commands/move
+func (w *impl) Move(key string, db uint) (bool, error) {
+	if empty(key) {
+		return boolErr("wredis: empty key")
+	}
+	if w.cfg.Cluster {
+		return boolErr("wredis: no move")
+	}
+	if db == w.cfg.DB {
+		return boolErr("wredis: move to same db")
+	}
+	return w.Bool(func(conn redis.Conn) (bool, error) {
+		return redis.Bool(conn.Do("MOVE", key, db))
+	})
+}
+
 // Rename will rename some "from" to "to".
 //
 // See: `http://redis.io/commands/rename`
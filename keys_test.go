@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	. "github.com/crowdriff/wredis"
+
 	"github.com/garyburd/redigo/redis"
 
 	. "github.com/onsi/ginkgo"
@@ -14,6 +16,55 @@ var _ = Describe("Keys", func() {
 	testKey := "wredis::test::keys"
 	testVal := "testvalue"
 
+	Describe("Copy", func() {
+		to := "wredis::test::copy"
+
+		AfterEach(func() {
+			Ω(unsafe.FlushAll()).Should(Succeed())
+		})
+
+		It("should copy a key successfully", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Copy(testKey, to, CopyOptions{})).Should(BeTrue())
+			Ω(safe.Get(to)).Should(Equal(testVal))
+			Ω(safe.Get(testKey)).Should(Equal(testVal))
+		})
+
+		It("should only replace an existing key if asked to", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Set(to, "other")).Should(Succeed())
+			Ω(safe.Copy(testKey, to, CopyOptions{})).Should(BeFalse())
+			Ω(safe.Get(to)).Should(Equal("other"))
+
+			Ω(safe.Copy(testKey, to, CopyOptions{Replace: true})).Should(BeTrue())
+			Ω(safe.Get(to)).Should(Equal(testVal))
+		})
+
+		It("should copy a key to another DB", func() {
+			db1 := uint(1)
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Copy(testKey, testKey, CopyOptions{DB: &db1})).Should(BeTrue())
+
+			w, err := safe.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(w.Get(testKey)).Should(Equal(testVal))
+		})
+
+		It("should fail given invalid keys", func() {
+			_, err := safe.Copy("", to, CopyOptions{})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: empty src"))
+
+			_, err = safe.Copy(testKey, "", CopyOptions{})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: empty dst"))
+
+			_, err = safe.Copy(testKey, testKey, CopyOptions{})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: src == dst"))
+		})
+	})
+
 	Describe("Del", func() {
 		BeforeEach(func() {
 			Ω(safe.Set(testKey, testVal)).Should(Succeed())
@@ -156,6 +207,58 @@ var _ = Describe("Keys", func() {
 		})
 	})
 
+	Describe("Move", func() {
+		AfterEach(func() {
+			Ω(unsafe.FlushAll()).Should(Succeed())
+		})
+
+		It("should move a key to another DB", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Move(testKey, 1)).Should(BeTrue())
+			Ω(safe.Exists(testKey)).Should(BeFalse())
+
+			w, err := safe.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(w.Get(testKey)).Should(Equal(testVal))
+
+			// the key exists in the DB
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Move(testKey, 1)).Should(BeFalse())
+		})
+
+		It("should fail given an empty key or the same DB", func() {
+			_, err := safe.Move("", 1)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: empty key"))
+
+			_, err = safe.Move(testKey, 0)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: move to same db"))
+		})
+	})
+
+	Describe("Scan", func() {
+		AfterEach(func() {
+			Ω(unsafe.FlushAll()).Should(Succeed())
+		})
+
+		It("should scan the keys matching a pattern", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+			Ω(safe.Set("other", testVal)).Should(Succeed())
+
+			cursor, keys, err := safe.Scan(0, "wredis::*", 100)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cursor).Should(BeZero())
+			Ω(keys).Should(Equal([]string{testKey}))
+		})
+
+		It("should fail given a negative count", func() {
+			_, _, err := safe.Scan(0, "", -1)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: invalid count"))
+		})
+	})
+
 	Describe("Rename", func() {
 		AfterEach(func() {
 			Ω(unsafe.FlushAll()).Should(Succeed())
@@ -0,0 +1,221 @@
+package wredis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// urlKey is the key used to load a connection URL (see FromURL), it is applied
+// before any other loaded values.
+const urlKey = "url"
+
+// FromEnv sets the values in the Config from environment variables, named
+// using the prefix and the upper cased `config` struct tag of the Config
+// field; e.g. FromEnv("WREDIS") loads WREDIS_HOST, WREDIS_MAX_ACTIVE, etc. A
+// connection URL may also be provided in <prefix>_URL.
+//
+// Durations are either a time.Duration string or a number of seconds. An
+// error is returned for any variable with the prefix that isn't recognised.
+func FromEnv(prefix string) Option {
+	return func(cfg Config) (Config, error) {
+		if prefix != "" && !strings.HasSuffix(prefix, "_") {
+			prefix += "_"
+		}
+
+		values := make(map[string]string)
+		for _, kv := range os.Environ() {
+			if !strings.HasPrefix(kv, prefix) {
+				continue
+			}
+			kv = strings.TrimPrefix(kv, prefix)
+			i := strings.IndexByte(kv, '=')
+			key := strings.ToLower(kv[:i])
+			if key != urlKey && configFields[key] == nil {
+				// without a prefix, we can't tell which variables are ours
+				if prefix == "" {
+					continue
+				}
+				return cfg, fmt.Errorf("wredis: unknown environment variable %q", prefix+kv[:i])
+			}
+			values[key] = kv[i+1:]
+		}
+
+		return loadValues(cfg, values)
+	}
+}
+
+// FromFile sets the values in the Config from a YAML, TOML or JSON file, using
+// the `config` struct tags of the Config fields as keys; e.g.
+//
+//	host: redis.internal
+//	max_active: 20
+//	idle_timeout: 5m
+//
+// The format is chosen by the file extension (.yaml, .yml, .toml or .json).
+// Durations are either a time.Duration string or a number of seconds. An error
+// is returned for any key that isn't recognised.
+func FromFile(path string) Option {
+	return func(cfg Config) (Config, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+
+		raw := make(map[string]interface{})
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &raw)
+		case ".toml":
+			_, err = toml.Decode(string(data), &raw)
+		case ".json":
+			err = json.Unmarshal(data, &raw)
+		default:
+			return cfg, fmt.Errorf("wredis: unsupported config file %q", ext)
+		}
+		if err != nil {
+			return cfg, err
+		}
+
+		values := make(map[string]string, len(raw))
+		for key, v := range raw {
+			if key != urlKey && configFields[key] == nil {
+				return cfg, fmt.Errorf("wredis: unknown config key %q", key)
+			}
+			switch v.(type) {
+			case string, bool, int, int64, uint64, float64:
+				values[key] = fmt.Sprint(v)
+			default:
+				return cfg, fmt.Errorf("wredis: invalid config value for %q", key)
+			}
+		}
+
+		return loadValues(cfg, values)
+	}
+}
+
+// loadValues sets the string values, keyed by `config` tag, into the Config
+func loadValues(cfg Config, values map[string]string) (Config, error) {
+	var err error
+	if rawurl, ok := values[urlKey]; ok {
+		if cfg, err = FromURL(rawurl)(cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	for key, value := range values {
+		if key == urlKey {
+			continue
+		}
+		field := v.FieldByIndex(configFields[key].Index)
+		if err = setConfigValue(field, value); err != nil {
+			return cfg, fmt.Errorf("wredis: invalid config value for %q", key)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setConfigValue parses the string into the Config field
+func setConfigValue(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+
+	if field.Type() == durationType {
+		d, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Uint:
+		n, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+	return nil
+}
+
+// configFields are the loadable Config fields, keyed by `config` tag
+var configFields = func() map[string]*reflect.StructField {
+	fields := make(map[string]*reflect.StructField)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _ := configTag(field)
+		if key == "" || key == "-" {
+			continue
+		}
+		fields[key] = &field
+	}
+	return fields
+}()
+
+// configTag returns the key and if the field is a secret, from the `config`
+// struct tag of a Config field.
+func configTag(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("config"), ",")
+	return tag[0], len(tag) > 1 && tag[1] == "secret"
+}
+
+// String returns the loadable values of the Config, in a logfmt style, with
+// secrets redacted. It is intended to be used for logging.
+func (c Config) String() string {
+	keys := make([]string, 0, len(configFields))
+	for key := range configFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	v := reflect.ValueOf(c)
+	pairs := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		field := configFields[key]
+		value := v.FieldByIndex(field.Index).Interface()
+		if _, secret := configTag(*field); secret && value != "" {
+			value = "REDACTED"
+		}
+		if s, ok := value.(string); ok {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", key, s))
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	secure := c.TLS != nil || c.tlsFiles != nil || c.InsecureSkipVerify
+	pairs = append(pairs, fmt.Sprintf("tls=%t", secure))
+
+	return strings.Join(pairs, " ")
+}
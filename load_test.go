@@ -0,0 +1,182 @@
+package wredis_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	// load applies the Option(s) to the default Config
+	load := func(opts ...Option) (Config, error) {
+		cfg, err := ParseURL("redis://")
+		Ω(err).ShouldNot(HaveOccurred())
+		return cfg.Copy(opts...)
+	}
+
+	Context("FromEnv", func() {
+		var env []string
+
+		setenv := func(key, value string) {
+			Ω(os.Setenv(key, value)).Should(Succeed())
+			env = append(env, key)
+		}
+
+		AfterEach(func() {
+			for _, key := range env {
+				Ω(os.Unsetenv(key)).Should(Succeed())
+			}
+			env = nil
+		})
+
+		It("should load the prefixed variables", func() {
+			setenv("WREDIS_TEST_HOST", "redis.test")
+			setenv("WREDIS_TEST_PORT", "6380")
+			setenv("WREDIS_TEST_DB", "2")
+			setenv("WREDIS_TEST_MAX_ACTIVE", "20")
+			setenv("WREDIS_TEST_IDLE_TIMEOUT", "5m")
+			setenv("WREDIS_TEST_MAX_CONN_LIFETIME", "30")
+			setenv("WREDIS_TEST_WAIT", "true")
+			setenv("WREDIS_TEST_PASSWORD", "secret")
+
+			cfg, err := load(FromEnv("WREDIS_TEST"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.Addr()).Should(Equal("redis.test:6380"))
+			Ω(cfg.DB).Should(BeEquivalentTo(2))
+			Ω(cfg.MaxActive).Should(Equal(20))
+			Ω(cfg.IdleTimeout).Should(Equal(5 * time.Minute))
+			Ω(cfg.MaxConnLifetime).Should(Equal(30 * time.Second))
+			Ω(cfg.Wait).Should(BeTrue())
+			Ω(cfg.Password).Should(Equal("secret"))
+			// untouched
+			Ω(cfg.MaxIdle).Should(Equal(3))
+		})
+
+		It("should load a connection url before the other variables", func() {
+			setenv("WREDIS_TEST_URL", "redis://:secret@redis.test:6380/1")
+			setenv("WREDIS_TEST_DB", "4")
+
+			cfg, err := load(FromEnv("WREDIS_TEST_"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.Addr()).Should(Equal("redis.test:6380"))
+			Ω(cfg.Password).Should(Equal("secret"))
+			Ω(cfg.DB).Should(BeEquivalentTo(4))
+		})
+
+		It("should fail given an unknown variable", func() {
+			setenv("WREDIS_TEST_MAX_ACTIV", "20")
+
+			_, err := load(FromEnv("WREDIS_TEST"))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: unknown environment variable "WREDIS_TEST_MAX_ACTIV"`))
+		})
+
+		It("should fail given an invalid value", func() {
+			setenv("WREDIS_TEST_MAX_ACTIVE", "lots")
+
+			_, err := load(FromEnv("WREDIS_TEST"))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: invalid config value for "max_active"`))
+		})
+
+		It("should validate the loaded config", func() {
+			setenv("WREDIS_TEST_PORT", "80")
+
+			_, err := load(FromEnv("WREDIS_TEST"))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: invalid port"))
+		})
+	})
+
+	Context("FromFile", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "wredis-load")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(dir)).Should(Succeed())
+		})
+
+		// writes the contents to a file in the temp dir, returning its path
+		write := func(name, contents string) string {
+			path := filepath.Join(dir, name)
+			Ω(ioutil.WriteFile(path, []byte(contents), 0600)).Should(Succeed())
+			return path
+		}
+
+		It("should load a yaml file", func() {
+			cfg, err := load(FromFile(write("redis.yaml", `
+host: redis.test
+port: 6380
+max_active: 20
+idle_timeout: 5m
+wait: true
+`)))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.Addr()).Should(Equal("redis.test:6380"))
+			Ω(cfg.MaxActive).Should(Equal(20))
+			Ω(cfg.IdleTimeout).Should(Equal(5 * time.Minute))
+			Ω(cfg.Wait).Should(BeTrue())
+		})
+
+		It("should load a toml file", func() {
+			cfg, err := load(FromFile(write("redis.toml", `
+host = "redis.test"
+port = 6380
+max_conn_lifetime = "1h"
+username = "app"
+`)))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.Addr()).Should(Equal("redis.test:6380"))
+			Ω(cfg.MaxConnLifetime).Should(Equal(time.Hour))
+			Ω(cfg.Username).Should(Equal("app"))
+		})
+
+		It("should load a json file", func() {
+			cfg, err := load(FromFile(write("redis.json", `{"socket": "/var/run/redis.sock", "network": "unix", "db": 3}`)))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.Addr()).Should(Equal("/var/run/redis.sock"))
+			Ω(cfg.DB).Should(BeEquivalentTo(3))
+		})
+
+		It("should fail given an unknown key", func() {
+			_, err := load(FromFile(write("redis.yaml", "hostname: redis.test\n")))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: unknown config key "hostname"`))
+		})
+
+		It("should fail given a nested value", func() {
+			_, err := load(FromFile(write("redis.yaml", "host:\n  name: redis.test\n")))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: invalid config value for "host"`))
+		})
+
+		It("should fail given an unsupported file", func() {
+			_, err := load(FromFile(write("redis.ini", "host=redis.test\n")))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal(`wredis: unsupported config file ".ini"`))
+		})
+	})
+
+	Context("String", func() {
+		It("should redact the password", func() {
+			cfg, err := load(Password("secret"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cfg.String()).ShouldNot(ContainSubstring("secret"))
+			Ω(cfg.String()).Should(ContainSubstring(`password="REDACTED"`))
+			Ω(cfg.String()).Should(ContainSubstring(`host="localhost"`))
+			Ω(cfg.String()).Should(ContainSubstring("port=6379"))
+			Ω(cfg.String()).Should(ContainSubstring("tls=false"))
+		})
+	})
+})
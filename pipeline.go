@@ -0,0 +1,418 @@
+package wredis
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// AutoPipeline enables automatic pipelining in the Config. Commands called
+// concurrently are coalesced into batched writes over conns multiplexed
+// connections, rather than each waiting for a connection from the pool; and
+// their replies are dispatched back in order.
+//
+// A batch is written once maxBatch commands are waiting, or once window has
+// elapsed since the first; with a window of 0 commands are written as soon as
+// there are no more waiting. A conns of 0 disables auto pipelining.
+//
+// Blocking commands (e.g. BLPOP), commands which change the connection's state
+// (e.g. MULTI, WATCH or SUBSCRIBE), commands with a timeout, and Send/Receive
+// are still sent over a dedicated connection from the pool. Select always
+// returns a Wredis without auto pipelining.
+//
+// The multiplexed connections are long lived, so are not subject to the pool's
+// IdleTimeout, MaxConnLifetime or TestOnBorrower. With Credentials, they're
+// re-AUTH'd ahead of the first batch written once the refresh has elapsed.
+func AutoPipeline(conns int, window time.Duration, maxBatch int) Option {
+	return func(cfg Config) (Config, error) {
+		if err := validatePipeline(conns, window, maxBatch); err != nil {
+			return cfg, err
+		}
+		cfg.AutoPipeline = conns
+		cfg.PipelineWindow = window
+		cfg.PipelineBatch = maxBatch
+		return cfg, nil
+	}
+}
+
+// validatePipeline validates the auto pipelining settings
+func validatePipeline(conns int, window time.Duration, maxBatch int) error {
+	if conns < 0 {
+		return errors.New("wredis: invalid auto pipeline")
+	}
+	if conns > 0 && window < 0 {
+		return errors.New("wredis: invalid pipeline window")
+	}
+	if conns > 0 && maxBatch < 1 {
+		return errors.New("wredis: invalid pipeline batch")
+	}
+	return nil
+}
+
+// errPipelineClosed is returned for commands sent after Close
+var errPipelineClosed = errors.New("wredis: pipeline closed")
+
+// pipelineReq is a command waiting to be pipelined, and then its reply
+type pipelineReq struct {
+	cmd  string
+	args []interface{}
+	call *respCall // sent instead of args, if set
+	auth bool      // a re-AUTH, whose failure closes the connection
+
+	reply interface{}
+	err   error
+	done  chan struct{}
+}
+
+var reqPool = sync.Pool{
+	New: func() interface{} {
+		return &pipelineReq{done: make(chan struct{}, 1)}
+	},
+}
+
+// pipelines are the multiplexed connections used for auto pipelining
+type pipelines struct {
+	next  uint32
+	lines []*pipeline
+}
+
+// newPipelines starts the configured number of pipelines
+func newPipelines(cfg Config) *pipelines {
+	ps := &pipelines{lines: make([]*pipeline, cfg.AutoPipeline)}
+	for i := range ps.lines {
+		ps.lines[i] = newPipeline(cfg)
+	}
+	return ps
+}
+
+// do pipelines the command on the next pipeline, and waits for its reply
+func (ps *pipelines) do(cmd string, args []interface{}) (interface{}, error) {
+	return ps.pipeline().do(cmd, args, nil)
+}
+
+// call pipelines the call on the next pipeline, and waits for its reply
+func (ps *pipelines) call(cmd string, call *respCall) error {
+	_, err := ps.pipeline().do(cmd, nil, call)
+	return err
+}
+
+// pipeline returns the next pipeline, round robin
+func (ps *pipelines) pipeline() *pipeline {
+	n := atomic.AddUint32(&ps.next, 1)
+	return ps.lines[int(n)%len(ps.lines)]
+}
+
+// Close stops all the pipelines, closing their connections once any commands
+// in flight have been replied to.
+func (ps *pipelines) Close() error {
+	for _, p := range ps.lines {
+		p.Close()
+	}
+	return nil
+}
+
+// pipeline writes batches of commands to a single connection, while its reader
+// reads their replies.
+type pipeline struct {
+	cfg      Config
+	dial     dialFunc
+	window   time.Duration
+	maxBatch int
+
+	reqs chan *pipelineReq
+	quit chan struct{}
+	once sync.Once
+	done sync.WaitGroup
+}
+
+func newPipeline(cfg Config) *pipeline {
+	p := &pipeline{
+		cfg:      cfg,
+		dial:     cfg.Dialer(cfg),
+		window:   cfg.PipelineWindow,
+		maxBatch: cfg.PipelineBatch,
+		reqs:     make(chan *pipelineReq),
+		quit:     make(chan struct{}),
+	}
+	p.done.Add(1)
+	go p.write()
+	return p
+}
+
+// do queues the command, or the call if there is one, and waits for its reply.
+// Calls are only pipelined over native connections, see Config.native.
+func (p *pipeline) do(cmd string, args []interface{}, call *respCall) (interface{}, error) {
+	req := reqPool.Get().(*pipelineReq)
+	req.cmd, req.args, req.call = cmd, args, call
+	select {
+	case p.reqs <- req:
+	case <-p.quit:
+		reqPool.Put(req)
+		return nil, errPipelineClosed
+	}
+
+	<-req.done
+	reply, err := req.reply, req.err
+	*req = pipelineReq{done: req.done}
+	reqPool.Put(req)
+	return reply, err
+}
+
+// Close stops the pipeline, and waits for any commands in flight
+func (p *pipeline) Close() error {
+	p.once.Do(func() { close(p.quit) })
+	p.done.Wait()
+	return nil
+}
+
+// write writes batches of commands to the connection, (re)dialing it when
+// needed, and passes each written batch to the reader.
+func (p *pipeline) write() {
+	defer p.done.Done()
+
+	var (
+		conn     redis.Conn
+		native   *respConn
+		inflight chan []*pipelineReq
+	)
+	defer func() {
+		if inflight != nil {
+			close(inflight)
+		}
+	}()
+
+	for {
+		batch := p.collect()
+		if batch == nil {
+			return
+		}
+
+		if conn == nil || conn.Err() != nil {
+			if inflight != nil {
+				close(inflight)
+				inflight = nil
+			}
+			var err error
+			if conn, err = p.dial(); err != nil {
+				conn = nil
+				fail(batch, err)
+				continue
+			}
+			native, _ = nativeConn(conn)
+			inflight = make(chan []*pipelineReq, 64)
+			p.done.Add(1)
+			go p.read(conn, inflight)
+		}
+
+		auth, err := p.reauth(conn)
+		if err != nil {
+			conn.Close()
+			fail(batch, err)
+			continue
+		}
+		if auth != nil {
+			batch = append([]*pipelineReq{auth}, batch...)
+		}
+
+		for _, req := range batch {
+			// errors are returned by Flush
+			if req.call != nil && native != nil {
+				native.sendCall(req.cmd, req.call)
+			} else {
+				conn.Send(req.cmd, req.args...)
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			conn.Close()
+		}
+		// the reader fails the batch if the connection is broken
+		inflight <- batch
+	}
+}
+
+// reauth returns an AUTH with fresh credentials, to be written ahead of the
+// batch, if the connection's credentials are due to be refreshed.
+func (p *pipeline) reauth(conn redis.Conn) (*pipelineReq, error) {
+	ac, ok := conn.(*authConn)
+	if !ok || !p.cfg.reauthenticates() || time.Since(ac.authed) < p.cfg.CredentialsRefresh {
+		return nil, nil
+	}
+	user, pass, err := p.cfg.credentials()
+	if err != nil {
+		return nil, err
+	}
+	ac.authed = time.Now()
+	args := authArgs(user, pass)
+	if args == nil {
+		return nil, nil
+	}
+	return &pipelineReq{cmd: "AUTH", args: args, auth: true}, nil
+}
+
+// collect returns the next batch of commands, or nil once the pipeline has
+// been closed.
+func (p *pipeline) collect() []*pipelineReq {
+	var batch []*pipelineReq
+	select {
+	case req := <-p.reqs:
+		size := p.maxBatch
+		if size > 16 {
+			size = 16
+		}
+		batch = append(make([]*pipelineReq, 0, size), req)
+	case <-p.quit:
+		return nil
+	}
+
+	var window <-chan time.Time
+	if p.window > 0 {
+		t := time.NewTimer(p.window)
+		defer t.Stop()
+		window = t.C
+	}
+
+	for len(batch) < p.maxBatch {
+		if window == nil {
+			select {
+			case req := <-p.reqs:
+				batch = append(batch, req)
+			default:
+				return batch
+			}
+			continue
+		}
+		select {
+		case req := <-p.reqs:
+			batch = append(batch, req)
+		case <-window:
+			return batch
+		}
+	}
+	return batch
+}
+
+// read reads the replies for each batch written to the connection, in order,
+// closing the connection once there are no more batches.
+func (p *pipeline) read(conn redis.Conn, inflight <-chan []*pipelineReq) {
+	defer p.done.Done()
+	defer conn.Close()
+
+	native, _ := nativeConn(conn)
+	for batch := range inflight {
+		for _, req := range batch {
+			if req.call != nil && native != nil {
+				req.err = native.receiveCall(req.call)
+			} else {
+				req.reply, req.err = conn.Receive()
+			}
+			if req.auth {
+				// the commands which follow would fail, or run unauthenticated
+				if req.err != nil {
+					conn.Close()
+				}
+				continue
+			}
+			req.done <- struct{}{}
+		}
+	}
+}
+
+// fail replies to all the commands in the batch with the error
+func fail(batch []*pipelineReq, err error) {
+	for _, req := range batch {
+		req.err = err
+		req.done <- struct{}{}
+	}
+}
+
+// nativeConn returns the *respConn if conn is one, allowing for it to be
+// wrapped by an *authConn.
+func nativeConn(conn redis.Conn) (*respConn, bool) {
+	if ac, ok := conn.(*authConn); ok {
+		conn = ac.Conn
+	}
+	rc, ok := conn.(*respConn)
+	return rc, ok
+}
+
+// pipelineConn is the redis.Conn returned by an auto pipelining Wredis.
+// Commands are pipelined, until one needs a connection of its own; from then
+// on everything is sent over a dedicated connection from the pool.
+type pipelineConn struct {
+	w    *impl
+	conn redis.Conn // dedicated, once needed
+}
+
+var _ redis.ConnWithTimeout = &pipelineConn{}
+
+// dedicated returns the dedicated connection, getting it from the pool
+func (c *pipelineConn) dedicated() redis.Conn {
+	if c.conn == nil {
+		c.conn = c.w.pool.Get()
+	}
+	return c.conn
+}
+
+// Close implements redis.Conn
+func (c *pipelineConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Err implements redis.Conn
+func (c *pipelineConn) Err() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Err()
+}
+
+// Do implements redis.Conn
+func (c *pipelineConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if c.conn == nil && cmd == "" {
+		// nothing has been sent, so there's nothing to flush
+		return nil, nil
+	}
+	if c.conn != nil || dedicated(cmd, args) {
+		return c.dedicated().Do(cmd, args...)
+	}
+	return c.w.pipelines.do(cmd, args)
+}
+
+// call implements caller
+func (c *pipelineConn) call(cmd string, call *respCall) error {
+	if c.conn != nil || dedicated(cmd, nil) {
+		return doCall(c.dedicated(), cmd, call)
+	}
+	return c.w.pipelines.call(cmd, call)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *pipelineConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.dedicated(), timeout, cmd, args...)
+}
+
+// Send implements redis.Conn
+func (c *pipelineConn) Send(cmd string, args ...interface{}) error {
+	return c.dedicated().Send(cmd, args...)
+}
+
+// Flush implements redis.Conn
+func (c *pipelineConn) Flush() error {
+	return c.dedicated().Flush()
+}
+
+// Receive implements redis.Conn
+func (c *pipelineConn) Receive() (interface{}, error) {
+	return c.dedicated().Receive()
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *pipelineConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.dedicated(), timeout)
+}
@@ -0,0 +1,137 @@
+package wredis_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AutoPipeline", func() {
+	It("should fail given invalid settings", func() {
+		_, err := Safe(AutoPipeline(-1, 0, 1))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid auto pipeline"))
+
+		_, err = Safe(AutoPipeline(1, -time.Millisecond, 1))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid pipeline window"))
+
+		_, err = Safe(AutoPipeline(1, 0, 0))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid pipeline batch"))
+	})
+
+	Context("Redis", func() {
+		var (
+			w     Wredis
+			dials int32
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&dials, 0)
+			dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+
+			var err error
+			w, err = Unsafe(AutoPipeline(1, time.Millisecond, 16), NetDialer(dial))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(w.FlushAll()).Should(Succeed())
+			Ω(w.Close()).Should(Succeed())
+		})
+
+		It("should pipeline concurrent commands over one connection", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					key := "wredis::test::pipeline::" + strconv.Itoa(i)
+					Ω(w.Set(key, strconv.Itoa(i))).Should(Succeed())
+					Ω(w.Get(key)).Should(Equal(strconv.Itoa(i)))
+					Ω(w.MGet(key, key)).Should(Equal([]string{strconv.Itoa(i), strconv.Itoa(i)}))
+				}(i)
+			}
+			wg.Wait()
+
+			Ω(atomic.LoadInt32(&dials)).Should(BeEquivalentTo(1))
+		})
+
+		It("should return error replies to the caller", func() {
+			Ω(w.Set("wredis::test::pipeline", "value")).Should(Succeed())
+			_, err := w.Incr("wredis::test::pipeline")
+			Ω(err).Should(HaveOccurred())
+			Ω(w.Get("wredis::test::pipeline")).Should(Equal("value"))
+		})
+
+		It("should use a dedicated connection for blocking commands", func() {
+			Ω(w.Ping()).Should(Equal("PONG"))
+
+			popped := make(chan []string)
+			go func() {
+				defer GinkgoRecover()
+				_, err := w.Int(func(conn redis.Conn) (int, error) {
+					vals, err := redis.Strings(conn.Do("BLPOP", "wredis::test::pipeline::list", 2))
+					popped <- vals
+					return 0, err
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+			}()
+
+			// pipelined commands aren't blocked by BLPOP
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&dials)
+			}).Should(BeEquivalentTo(2))
+			Ω(w.RPush("wredis::test::pipeline::list", "value")).Should(BeEquivalentTo(1))
+			Eventually(popped).Should(Receive(Equal([]string{"wredis::test::pipeline::list", "value"})))
+		})
+
+		It("should use a dedicated connection for Send/Receive", func() {
+			_, err := w.Int(func(conn redis.Conn) (int, error) {
+				Ω(conn.Send("SET", "wredis::test::pipeline", "value")).Should(Succeed())
+				Ω(conn.Send("GET", "wredis::test::pipeline")).Should(Succeed())
+				Ω(redis.Values(conn.Do(""))).Should(Equal([]interface{}{"OK", []byte("value")}))
+				return 0, nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should not auto pipeline a Select'd Wredis", func() {
+			db, err := w.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer db.Close()
+
+			Ω(db.Set("wredis::test::pipeline", "value")).Should(Succeed())
+			Ω(db.Get("wredis::test::pipeline")).Should(Equal("value"))
+			Ω(w.Exists("wredis::test::pipeline")).Should(BeFalse())
+		})
+	})
+
+	It("should fail commands after Close", func() {
+		w, err := Safe(AutoPipeline(2, 0, 8))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.Ping()).Should(Equal("PONG"))
+		Ω(w.Close()).Should(Succeed())
+
+		_, err = w.Get("wredis::test::pipeline")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: pipeline closed"))
+	})
+})
@@ -0,0 +1,339 @@
+package wredis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrDenied is returned, without sending the command, when a command is
+// denied by the Policy.
+var ErrDenied = errors.New("wredis: denied by policy")
+
+// Policy decides which commands a Wredis may send. It's enforced for every
+// command, including those sent using Do or a redis.Conn from Conn; a denied
+// command fails with ErrDenied.
+//
+// Commands are named as in Redis ("DEL", or "CONFIG|SET" for a subcommand);
+// or by category: "@read", "@write", "@admin", "@dangerous", "@pubsub",
+// "@scripting", "@connection", "@transaction" and "@blocking". Commands wredis
+// doesn't list are classified, and their keys found, using the flags, ACL
+// categories and key specs from Redis' COMMAND INFO. With Allow or KeyPatterns,
+// a command which can't be classified, or whose keys can't all be found, is
+// denied.
+type Policy struct {
+	// Allow are the commands which are allowed, if empty any command which
+	// isn't denied is allowed
+	Allow []string
+	// Deny are the commands which are denied, even if allowed by Allow
+	Deny []string
+	// KeyPatterns are the glob-style patterns (as used by KEYS) which every key
+	// sent must match, if empty any key is allowed
+	KeyPatterns []string
+	// MaxDelKeys is the most keys a single DEL or UNLINK may delete, 0 is
+	// unlimited
+	MaxDelKeys int
+}
+
+// SafePolicy is the Policy used by Safe: it denies "@dangerous" commands,
+// such as FLUSHALL, FLUSHDB and SWAPDB.
+func SafePolicy() Policy {
+	return Policy{Deny: []string{"@dangerous"}}
+}
+
+// UnsafePolicy is the Policy used by Unsafe: it allows any command.
+func UnsafePolicy() Policy {
+	return Policy{}
+}
+
+// CommandPolicy sets the Policy in the Config, replacing the SafePolicy (or
+// UnsafePolicy) preset.
+func CommandPolicy(policy Policy) Option {
+	return func(cfg Config) (Config, error) {
+		for _, names := range [][]string{policy.Allow, policy.Deny} {
+			for _, name := range names {
+				if empty(name) {
+					return cfg, errors.New("wredis: empty policy command")
+				}
+				if _, ok := categories[strings.ToLower(name)]; name[0] == '@' && !ok {
+					return cfg, fmt.Errorf("wredis: unknown command category %q", name)
+				}
+			}
+		}
+		for _, pattern := range policy.KeyPatterns {
+			if empty(pattern) {
+				return cfg, errors.New("wredis: empty key pattern")
+			}
+		}
+		if policy.MaxDelKeys < 0 {
+			return cfg, errors.New("wredis: invalid max del keys")
+		}
+		cfg.Policy = policy
+		return cfg, nil
+	}
+}
+
+// allows returns true if the command (and subcommand), which is listed in the
+// table, is allowed by name and category
+func (p Policy) allows(cmd string, args []interface{}) bool {
+	return p.allowed(cmd, args, classification{cats: categoriesOf(cmd, args), known: true})
+}
+
+// allowed returns true if the classified command is allowed by name and
+// category. A command which couldn't be classified is only allowed if there's
+// no Allow list.
+func (p Policy) allowed(cmd string, args []interface{}, c classification) bool {
+	matches := func(names []string) bool {
+		for _, n := range names {
+			if n[0] == '@' {
+				if categories[strings.ToLower(n)]&c.cats != 0 {
+					return true
+				}
+			} else if strings.EqualFold(n, cmd) || isSubcommand(n, cmd, args) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if matches(p.Deny) {
+		return false
+	}
+	return len(p.Allow) == 0 || (c.known && matches(p.Allow))
+}
+
+// isSubcommand returns true if name is the "COMMAND|SUBCOMMAND" being sent
+func isSubcommand(name, cmd string, args []interface{}) bool {
+	i := strings.IndexByte(name, '|')
+	if i < 0 || len(args) == 0 || !strings.EqualFold(name[:i], cmd) {
+		return false
+	}
+	return strings.EqualFold(name[i+1:], argString(args[0]))
+}
+
+// allowsCategory returns true if the category isn't denied, and is allowed
+func (p Policy) allowsCategory(category string) bool {
+	for _, n := range p.Deny {
+		if strings.EqualFold(n, category) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, n := range p.Allow {
+		if strings.EqualFold(n, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// restricts returns true if the Policy may deny a command
+func (p Policy) restricts() bool {
+	return len(p.Allow) > 0 || len(p.Deny) > 0 || len(p.KeyPatterns) > 0 || p.MaxDelKeys > 0
+}
+
+// check returns an error if the classified command may not be sent. If there
+// are KeyPatterns, a command whose keys can't all be found is denied.
+func (p Policy) check(cmd string, args []interface{}, c classification) error {
+	if !p.allowed(cmd, args, c) {
+		return fmt.Errorf("%w: %s", ErrDenied, strings.ToUpper(cmd))
+	}
+
+	if p.MaxDelKeys > 0 && len(args) > p.MaxDelKeys {
+		switch strings.ToUpper(cmd) {
+		case "DEL", "UNLINK":
+			return fmt.Errorf("%w: %s of %d keys exceeds %d", ErrDenied, strings.ToUpper(cmd), len(args), p.MaxDelKeys)
+		}
+	}
+
+	if len(p.KeyPatterns) > 0 {
+		if !c.complete {
+			return fmt.Errorf("%w: %s keys unknown", ErrDenied, strings.ToUpper(cmd))
+		}
+		for _, i := range c.keyIndexes(args) {
+			if key := argString(args[i]); !p.matchesKey(key) {
+				return fmt.Errorf("%w: %s key %q", ErrDenied, strings.ToUpper(cmd), key)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesKey returns true if the key matches any of the KeyPatterns
+func (p Policy) matchesKey(key string) bool {
+	for _, pattern := range p.KeyPatterns {
+		if globMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches the string against the glob-style pattern, using the same
+// rules as Redis: "*", "?", "[...]" (with "^" and ranges) and "\" escapes.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// an unterminated class matches literally
+				if s[0] != '[' {
+					return false
+				}
+				s = s[1:]
+				break
+			}
+			class := pattern[1 : end+1]
+			if !classMatch(class, s[0]) {
+				return false
+			}
+			pattern = pattern[end+1:]
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// classMatch matches the byte against a "[...]" class, without the brackets
+func classMatch(class string, c byte) bool {
+	not := len(class) > 0 && class[0] == '^'
+	if not {
+		class = class[1:]
+	}
+	match := false
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			match = match || class[i] == c
+		case i+2 < len(class) && class[i+1] == '-':
+			lo, hi := class[i], class[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (c >= lo && c <= hi)
+			i += 2
+		default:
+			match = match || class[i] == c
+		}
+	}
+	return match != not
+}
+
+// check returns an error if the command may not be sent, as it's denied by
+// the Policy or we're read only
+func (w *impl) check(cmd string, args []interface{}) error {
+	if cmd == "" {
+		return nil
+	}
+
+	if p := w.cfg.Policy; p.restricts() {
+		if err := p.check(cmd, args, w.classify(cmd, args)); err != nil {
+			return err
+		}
+	}
+	if w.cfg.ReadOnly && w.writes(cmd, args) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// checkCall is check for a call. Its arguments are only converted when they
+// are needed: to match or count its keys, to find its subcommand, or to
+// classify a command which isn't listed.
+func (w *impl) checkCall(cmd string, call *respCall) error {
+	var args []interface{}
+	p := w.cfg.Policy
+	_, listed := listedCommand(cmd)
+	if len(p.KeyPatterns) > 0 || p.MaxDelKeys > 0 || hasSubcommands(cmd) || !listed {
+		args = make([]interface{}, len(call.args))
+		for i, arg := range call.args {
+			args[i] = arg
+		}
+	}
+	return w.check(cmd, args)
+}
+
+// policyConn is a redis.Conn which checks every command against the Policy,
+// and if we're read only, before sending it.
+type policyConn struct {
+	redis.Conn
+	w *impl
+}
+
+var _ redis.ConnWithTimeout = &policyConn{}
+
+// Do implements redis.Conn
+func (c *policyConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if err := c.w.check(cmd, args); err != nil {
+		return nil, err
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+// call implements caller
+func (c *policyConn) call(cmd string, call *respCall) error {
+	if err := c.w.checkCall(cmd, call); err != nil {
+		return err
+	}
+	return doCall(c.Conn, cmd, call)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *policyConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if err := c.w.check(cmd, args); err != nil {
+		return nil, err
+	}
+	return doWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+// Send implements redis.Conn
+func (c *policyConn) Send(cmd string, args ...interface{}) error {
+	if err := c.w.check(cmd, args); err != nil {
+		return err
+	}
+	return c.Conn.Send(cmd, args...)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *policyConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
@@ -0,0 +1,329 @@
+package wredis_test
+
+import (
+	"errors"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	var w Wredis
+
+	newWredis := func(policy Policy) {
+		var err error
+		w, err = Safe(CommandPolicy(policy))
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	denied := func(err error) {
+		Ω(err).Should(HaveOccurred())
+		Ω(errors.Is(err, ErrDenied)).Should(BeTrue())
+	}
+
+	AfterEach(func() {
+		if w != nil {
+			Ω(w.Close()).Should(Succeed())
+			w = nil
+		}
+		Ω(unsafe.FlushAll()).Should(Succeed())
+	})
+
+	It("should fail given an invalid policy", func() {
+		_, err := Safe(CommandPolicy(Policy{Deny: []string{"@nope"}}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal(`wredis: unknown command category "@nope"`))
+
+		_, err = Safe(CommandPolicy(Policy{Allow: []string{""}}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty policy command"))
+
+		_, err = Safe(CommandPolicy(Policy{MaxDelKeys: -1}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid max del keys"))
+	})
+
+	Context("presets", func() {
+		It("should deny dangerous commands when safe", func() {
+			_, err := safe.Do("FLUSHALL")
+			denied(err)
+			Ω(err.Error()).Should(Equal("wredis: denied by policy: FLUSHALL"))
+
+			Ω(safe.Do("SET", "wredis::test::policy", "value")).Should(Equal("OK"))
+		})
+
+		It("should allow dangerous commands when unsafe", func() {
+			Ω(unsafe.Do("FLUSHDB")).Should(Equal("OK"))
+		})
+
+		It("should be inherited by Select", func() {
+			db, err := safe.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = db.Do("FLUSHDB")
+			denied(err)
+		})
+	})
+
+	It("should deny commands by name", func() {
+		newWredis(Policy{Deny: []string{"incr"}})
+
+		_, err := w.Incr("wredis::test::policy")
+		denied(err)
+		_, err = w.Do("INCR", "wredis::test::policy")
+		denied(err)
+		Ω(w.Set("wredis::test::policy", "1")).Should(Succeed())
+	})
+
+	It("should only allow the allowed commands", func() {
+		newWredis(Policy{Allow: []string{"@read", "PING"}})
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+		_, err := w.Exists("wredis::test::policy")
+		Ω(err).ShouldNot(HaveOccurred())
+		denied(w.Set("wredis::test::policy", "value"))
+	})
+
+	It("should deny subcommands", func() {
+		newWredis(Policy{Deny: []string{"CONFIG|SET"}})
+
+		_, err := w.Do("CONFIG", "SET", "maxmemory", "0")
+		denied(err)
+		_, err = w.Do("config", "get", "maxmemory")
+		Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+	})
+
+	It("should deny subcommands wredis doesn't know of", func() {
+		newWredis(Policy{Deny: []string{"OBJECT|ENCODING"}})
+
+		_, err := w.Do("object", "encoding", "wredis::test::policy")
+		denied(err)
+		_, err = w.Do("OBJECT", "FREQ", "wredis::test::policy")
+		Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+	})
+
+	It("should only allow keys matching the key patterns", func() {
+		newWredis(Policy{KeyPatterns: []string{"wredis::test::*"}})
+
+		Ω(w.Set("wredis::test::policy", "value")).Should(Succeed())
+		denied(w.Set("other", "value"))
+		_, err := w.MGet("wredis::test::policy", "other")
+		denied(err)
+		Ω(w.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should cap the keys deleted by DEL", func() {
+		newWredis(Policy{MaxDelKeys: 2})
+
+		Ω(w.Del("a", "b")).Should(BeEquivalentTo(0))
+		_, err := w.Del("a", "b", "c")
+		denied(err)
+		_, err = w.Do("UNLINK", "a", "b", "c")
+		denied(err)
+	})
+
+	It("should DelPattern in batches of MaxDelKeys", func() {
+		var err error
+		w, err = Unsafe(CommandPolicy(Policy{MaxDelKeys: 2}))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			Ω(w.Set("wredis::test::policy::"+key, "value")).Should(Succeed())
+		}
+		Ω(w.DelPattern("wredis::test::policy::*")).Should(BeEquivalentTo(5))
+	})
+
+	It("should require @dangerous for DelPattern", func() {
+		newWredis(Policy{Deny: []string{"@dangerous"}})
+
+		_, err := w.DelPattern("wredis::test::*")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: DelPattern requires unsafe impl. See wredis.Unsafe"))
+	})
+
+	Context("commands which aren't listed", func() {
+		geoAdd := []interface{}{"13.361389", "38.115556", "palermo"}
+
+		It("should classify them using COMMAND INFO", func() {
+			newWredis(Policy{Deny: []string{"@write"}})
+
+			_, err := w.Do("GEOADD", append([]interface{}{"wredis::test::policy"}, geoAdd...)...)
+			denied(err)
+			_, err = w.Do("ZRANGEBYSCORE", "wredis::test::policy", "0", "1")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should allow them by category", func() {
+			newWredis(Policy{Allow: []string{"@read"}})
+
+			_, err := w.Do("GEOADD", append([]interface{}{"wredis::test::policy"}, geoAdd...)...)
+			denied(err)
+			_, err = w.Do("ZRANGEBYSCORE", "wredis::test::policy", "0", "1")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should match their keys against the key patterns", func() {
+			newWredis(Policy{KeyPatterns: []string{"wredis::test::*"}})
+
+			Ω(w.Do("GEOADD", append([]interface{}{"wredis::test::policy"}, geoAdd...)...)).Should(BeEquivalentTo(1))
+			_, err := w.Do("GEOADD", append([]interface{}{"other"}, geoAdd...)...)
+			denied(err)
+		})
+	})
+
+	It("should match SORT's STORE key against the key patterns", func() {
+		newWredis(Policy{KeyPatterns: []string{"wredis::test::*"}})
+
+		// the miniredis test server doesn't implement SORT, so isn't asked
+		_, err := w.Do("SORT", "wredis::test::policy", "ALPHA", "STORE", "wredis::test::dst")
+		Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+		_, err = w.Do("SORT", "wredis::test::policy", "ALPHA", "STORE", "other")
+		denied(err)
+		_, err = w.Do("SORT", "other", "STORE", "wredis::test::dst")
+		denied(err)
+	})
+
+	Context("commands described by Redis 7 COMMAND INFO", func() {
+		var server *fakeServer
+
+		// list returns its arguments, as an array reply
+		list := func(values ...interface{}) []interface{} { return values }
+
+		// spec returns a Redis 7 key spec
+		spec := func(flag string, begin, find []interface{}) []interface{} {
+			return list("flags", list("RW", flag), "begin_search", begin, "find_keys", find)
+		}
+		index := func(i int) []interface{} {
+			return list("type", "index", "spec", list("index", i))
+		}
+		keyword := func(k string, from int) []interface{} {
+			return list("type", "keyword", "spec", list("keyword", k, "startfrom", from))
+		}
+		keyRange := func(last int) []interface{} {
+			return list("type", "range", "spec", list("lastkey", last, "keystep", 1, "limit", 0))
+		}
+		keyNum := func() []interface{} {
+			return list("type", "keynum", "spec", list("keynumidx", 0, "firstkey", 1, "keystep", 1))
+		}
+		command := func(name string, specs ...interface{}) []interface{} {
+			return list(name, -2, list("write"), 0, 0, 0, list("@write"), list(), specs, list())
+		}
+
+		newFakeWredis := func(policy Policy) {
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), CommandPolicy(policy))
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		sent := func(cmd string) bool {
+			for _, args := range server.Commands() {
+				if args[0] == cmd {
+					return true
+				}
+			}
+			return false
+		}
+
+		BeforeEach(func() {
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("COMMAND", func(args []string) string {
+				switch args[2] {
+				case "mod.store":
+					return fakeReply(list(command("mod.store",
+						spec("access", index(1), keyRange(0)),
+						spec("insert", keyword("STORE", 2), keyRange(0)),
+					)))
+				case "mod.num":
+					return fakeReply(list(command("mod.num", spec("access", index(1), keyNum()))))
+				case "mod.movable":
+					return fakeReply(list(command("mod.movable", spec("incomplete", index(1), keyRange(0)))))
+				}
+				return fakeReply(list(nil))
+			})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should find their keys using Redis 7 key specs", func() {
+			newFakeWredis(Policy{KeyPatterns: []string{"ok:*"}})
+
+			_, err := w.Do("mod.store", "ok:a", "x", "STORE", "ok:b")
+			Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+			Ω(sent("mod.store")).Should(BeTrue())
+			_, err = w.Do("mod.store", "ok:a", "STORE", "other")
+			denied(err)
+
+			_, err = w.Do("mod.num", "2", "ok:a", "ok:b")
+			Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+			_, err = w.Do("mod.num", "2", "ok:a", "other")
+			denied(err)
+		})
+
+		It("should deny them given key patterns", func() {
+			newFakeWredis(Policy{KeyPatterns: []string{"ok:*"}})
+
+			_, err := w.Do("mod.movable", "ok:a")
+			denied(err)
+			Ω(err.Error()).Should(Equal("wredis: denied by policy: MOD.MOVABLE keys unknown"))
+			_, err = w.Do("mod.unknown", "ok:a")
+			denied(err)
+			Ω(sent("mod.movable") || sent("mod.unknown")).Should(BeFalse())
+		})
+
+		It("should deny them given allowed commands", func() {
+			newFakeWredis(Policy{Allow: []string{"@write", "mod.unknown"}})
+
+			_, err := w.Do("mod.unknown", "key")
+			denied(err)
+			_, err = w.Do("mod.movable", "key")
+			Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+		})
+
+		It("should deny them without asking again when COMMAND INFO fails", func() {
+			server.Handle("COMMAND", func([]string) string {
+				return "-NOPERM this user has no permissions to run the 'command' command\r\n"
+			})
+			newFakeWredis(Policy{Allow: []string{"@read"}})
+
+			_, err := w.Do("mod.read", "key")
+			denied(err)
+			_, err = w.Do("mod.read", "key")
+			denied(err)
+			Ω(sent("mod.read")).Should(BeFalse())
+
+			infos := 0
+			for _, args := range server.Commands() {
+				if args[0] == "COMMAND" {
+					infos++
+				}
+			}
+			Ω(infos).Should(Equal(1))
+		})
+
+		It("should allow them given only denied commands", func() {
+			newFakeWredis(Policy{Deny: []string{"@dangerous"}})
+
+			_, err := w.Do("mod.unknown", "key")
+			Ω(errors.Is(err, ErrDenied)).Should(BeFalse())
+			Ω(sent("mod.unknown")).Should(BeTrue())
+		})
+	})
+
+	It("should match glob-style patterns like Redis", func() {
+		Ω(GlobMatch("h?llo", "hello")).Should(BeTrue())
+		Ω(GlobMatch("h*llo", "heeeello")).Should(BeTrue())
+		Ω(GlobMatch("h[ae]llo", "hallo")).Should(BeTrue())
+		Ω(GlobMatch("h[ae]llo", "hillo")).Should(BeFalse())
+		Ω(GlobMatch("h[^e]llo", "hallo")).Should(BeTrue())
+		Ω(GlobMatch("h[^e]llo", "hello")).Should(BeFalse())
+		Ω(GlobMatch("h[a-b]llo", "hbllo")).Should(BeTrue())
+		Ω(GlobMatch(`h\*llo`, "h*llo")).Should(BeTrue())
+		Ω(GlobMatch(`h\*llo`, "hello")).Should(BeFalse())
+		Ω(GlobMatch("a/*", "a/b/c")).Should(BeTrue())
+	})
+})
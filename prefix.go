@@ -0,0 +1,228 @@
+package wredis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrUnknownKeys is returned, without sending the command, when a Wredis with a
+// KeyPrefix can't find all the keys of a command to prefix them.
+var ErrUnknownKeys = errors.New("wredis: unknown keys")
+
+// KeyPrefix sets the KeyPrefix in the Config. The prefix is prepended to every
+// key sent, by every command (including Do, and a redis.Conn from Conn); and
+// to the patterns of KEYS and SCAN, which only return the keys with the
+// prefix, and with it removed. This keeps the Wredis in its namespace, e.g.
+// DelPattern("*") only deletes the prefixed keys.
+//
+// The keys of commands wredis doesn't list are found using Redis' COMMAND
+// INFO, as for a Policy. A command whose keys can't all be found fails with
+// ErrUnknownKeys, rather than being sent with its keys unprefixed.
+//
+// Keys in other arguments (e.g. the BY and GET patterns of SORT), and those in
+// replies other than from KEYS and SCAN, are left as they are. A Policy's
+// KeyPatterns are matched against the keys before the prefix is prepended.
+func KeyPrefix(prefix string) Option {
+	return func(cfg Config) (Config, error) {
+		cfg.KeyPrefix = prefix
+		return cfg, nil
+	}
+}
+
+// escapeGlob escapes the glob-style pattern characters in s, so it only
+// matches itself
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// prefixConn is a redis.Conn which prepends the prefix to the keys of the
+// commands sent, and removes it from the keys returned by KEYS and SCAN.
+type prefixConn struct {
+	redis.Conn
+	w       *impl
+	prefix  string
+	pending []string // the commands sent, whose replies haven't been received
+}
+
+var _ redis.ConnWithTimeout = &prefixConn{}
+
+// unknownKeys returns the error for a command whose keys can't all be found
+func unknownKeys(cmd string) error {
+	return fmt.Errorf("%w: %s", ErrUnknownKeys, strings.ToUpper(cmd))
+}
+
+// args returns the arguments with the keys, and patterns, prefixed
+func (c *prefixConn) args(cmd string, args []interface{}) ([]interface{}, error) {
+	class := c.w.classify(cmd, args)
+	if !class.complete {
+		return nil, unknownKeys(cmd)
+	}
+	keys := class.keyIndexes(args)
+	name := strings.ToUpper(cmd)
+	if len(keys) == 0 && name != "KEYS" && name != "SCAN" {
+		return args, nil
+	}
+
+	prefixed := make([]interface{}, len(args), len(args)+2)
+	copy(prefixed, args)
+	for _, i := range keys {
+		prefixed[i] = c.prefix + argString(args[i])
+	}
+
+	switch name {
+	case "KEYS":
+		if len(args) > 0 {
+			prefixed[0] = escapeGlob(c.prefix) + argString(args[0])
+		}
+	case "SCAN":
+		matched := false
+		for i := 1; i+1 < len(args); i++ {
+			if strings.EqualFold(argString(args[i]), "MATCH") {
+				prefixed[i+1] = escapeGlob(c.prefix) + argString(args[i+1])
+				matched = true
+				i++
+			}
+		}
+		if !matched {
+			prefixed = append(prefixed, "MATCH", escapeGlob(c.prefix)+"*")
+		}
+	}
+	return prefixed, nil
+}
+
+// strip removes the prefix from the keys returned by KEYS and SCAN
+func (c *prefixConn) strip(cmd string, reply interface{}) interface{} {
+	switch strings.ToUpper(cmd) {
+	case "KEYS":
+		return c.stripKeys(reply)
+	case "SCAN":
+		if values, ok := reply.([]interface{}); ok && len(values) == 2 {
+			return []interface{}{values[0], c.stripKeys(values[1])}
+		}
+	}
+	return reply
+}
+
+// stripKeys removes the prefix from each of the keys
+func (c *prefixConn) stripKeys(reply interface{}) interface{} {
+	keys, ok := reply.([]interface{})
+	if !ok {
+		return reply
+	}
+	stripped := make([]interface{}, len(keys))
+	for i, key := range keys {
+		switch key := key.(type) {
+		case []byte:
+			stripped[i] = bytes.TrimPrefix(key, []byte(c.prefix))
+		case string:
+			stripped[i] = strings.TrimPrefix(key, c.prefix)
+		default:
+			stripped[i] = key
+		}
+	}
+	return stripped
+}
+
+// Do implements redis.Conn
+func (c *prefixConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return c.Conn.Do(cmd)
+	}
+	prefixed, err := c.args(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	c.pending = c.pending[:0]
+	reply, err := c.Conn.Do(cmd, prefixed...)
+	return c.strip(cmd, reply), err
+}
+
+// call implements caller, prefixing the call's keys in place
+func (c *prefixConn) call(cmd string, call *respCall) error {
+	// the arguments are only needed to classify a command which isn't listed
+	var args []interface{}
+	if _, listed := listedCommand(cmd); !listed {
+		args = make([]interface{}, len(call.args))
+		for i, arg := range call.args {
+			args[i] = arg
+		}
+	}
+	class := c.w.classify(cmd, args)
+	if !class.complete {
+		return unknownKeys(cmd)
+	}
+
+	c.pending = c.pending[:0]
+	keys := findKeys(class.keys, len(call.args), func(i int) string {
+		return call.args[i]
+	})
+	for _, i := range keys {
+		call.args[i] = c.prefix + call.args[i]
+	}
+	return doCall(c.Conn, cmd, call)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *prefixConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return redis.DoWithTimeout(c.Conn, timeout, cmd)
+	}
+	prefixed, err := c.args(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	c.pending = c.pending[:0]
+	reply, err := doWithTimeout(c.Conn, timeout, cmd, prefixed...)
+	return c.strip(cmd, reply), err
+}
+
+// Send implements redis.Conn
+func (c *prefixConn) Send(cmd string, args ...interface{}) error {
+	prefixed, err := c.args(cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := c.Conn.Send(cmd, prefixed...); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, cmd)
+	return nil
+}
+
+// Receive implements redis.Conn
+func (c *prefixConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	return c.received(reply), err
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *prefixConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	return c.received(reply), err
+}
+
+// received strips the reply of the oldest pending command
+func (c *prefixConn) received(reply interface{}) interface{} {
+	if len(c.pending) == 0 {
+		return reply
+	}
+	cmd := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.strip(cmd, reply)
+}
@@ -0,0 +1,140 @@
+package wredis_test
+
+import (
+	"sort"
+
+	. "github.com/crowdriff/wredis"
+
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyPrefix", func() {
+	prefix := "wredis::test::prefix:"
+	var w Wredis
+
+	BeforeEach(func() {
+		var err error
+		w, err = Unsafe(KeyPrefix(prefix))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Ω(w.Close()).Should(Succeed())
+		Ω(unsafe.FlushAll()).Should(Succeed())
+	})
+
+	It("should prefix keys", func() {
+		Ω(w.Set("a", "1")).Should(Succeed())
+		Ω(safe.Get(prefix + "a")).Should(Equal("1"))
+		Ω(w.Get("a")).Should(Equal("1"))
+		Ω(w.MGet("a", "b")).Should(Equal([]string{"1", ""}))
+		Ω(w.Do("GET", "a")).Should(BeEquivalentTo("1"))
+	})
+
+	It("should prefix every key of a command", func() {
+		Ω(w.SAdd("x", "1", "2")).Should(BeEquivalentTo(2))
+		Ω(w.SAdd("y", "2", "3")).Should(BeEquivalentTo(2))
+		Ω(w.SUnionStore("z", "x", "y")).Should(BeEquivalentTo(3))
+		Ω(safe.SCard(prefix + "z")).Should(BeEquivalentTo(3))
+
+		Ω(w.Rename("z", "renamed")).Should(Succeed())
+		Ω(safe.Exists(prefix + "renamed")).Should(BeTrue())
+	})
+
+	It("should prefix the keys of scripts", func() {
+		Ω(w.Set("a", "1")).Should(Succeed())
+		script := "return redis.call('GET', KEYS[1]) .. ARGV[1]"
+		Ω(redis.String(w.Do("EVAL", script, 1, "a", "!"))).Should(Equal("1!"))
+	})
+
+	It("should prefix the keys of commands wredis doesn't list", func() {
+		Ω(w.Do("GEOADD", "places", "13.361389", "38.115556", "palermo")).Should(BeEquivalentTo(1))
+		Ω(safe.Exists(prefix + "places")).Should(BeTrue())
+
+		Ω(w.Do("ZADD", "z", 1, "one")).Should(BeEquivalentTo(1))
+		Ω(redis.Strings(w.Do("ZRANGEBYSCORE", "z", "-inf", "+inf"))).Should(Equal([]string{"one"}))
+	})
+
+	It("should not send commands whose keys can't be found", func() {
+		_, err := w.Do("MOD.UNKNOWN", "a")
+		Ω(err).Should(MatchError(ErrUnknownKeys))
+		Ω(err.Error()).Should(Equal("wredis: unknown keys: MOD.UNKNOWN"))
+
+		_, err = w.Int(func(conn redis.Conn) (int, error) {
+			return 0, conn.Send("MOD.UNKNOWN", "a")
+		})
+		Ω(err).Should(MatchError(ErrUnknownKeys))
+	})
+
+	It("should prefix the STORE key of SORT", func() {
+		server, err := newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer server.Close()
+		server.Handle("SORT", func([]string) string { return ":0\r\n" })
+		f, err := Safe(Host("127.0.0.1"), Port(server.Port()), KeyPrefix("p:"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		_, err = f.Do("SORT", "k", "BY", "w_*", "STORE", "dst")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(server.Commands()).Should(ContainElement([]string{"SORT", "p:k", "BY", "w_*", "STORE", "p:dst"}))
+	})
+
+	It("should only return its own keys, without the prefix", func() {
+		Ω(w.Set("a", "1")).Should(Succeed())
+		Ω(w.Set("b", "2")).Should(Succeed())
+		Ω(safe.Set("other", "3")).Should(Succeed())
+
+		keys, err := w.Keys("*")
+		Ω(err).ShouldNot(HaveOccurred())
+		sort.Strings(keys)
+		Ω(keys).Should(Equal([]string{"a", "b"}))
+
+		var scanned []string
+		cursor := uint64(0)
+		for {
+			var page []string
+			cursor, page, err = w.Scan(cursor, "", 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			scanned = append(scanned, page...)
+			if cursor == 0 {
+				break
+			}
+		}
+		sort.Strings(scanned)
+		Ω(scanned).Should(Equal([]string{"a", "b"}))
+
+		_, keys, err = w.Scan(0, "a*", 0)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(keys).Should(Equal([]string{"a"}))
+	})
+
+	It("should not DelPattern outside of the prefix", func() {
+		Ω(w.Set("a", "1")).Should(Succeed())
+		Ω(safe.Set("other", "3")).Should(Succeed())
+
+		Ω(w.DelPattern("*")).Should(BeEquivalentTo(1))
+		Ω(safe.Exists("other")).Should(BeTrue())
+	})
+
+	It("should escape glob characters in the prefix", func() {
+		g, err := Safe(KeyPrefix("wredis[test]:"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer g.Close()
+
+		Ω(g.Set("a", "1")).Should(Succeed())
+		Ω(safe.Set("wredist:b", "2")).Should(Succeed())
+		Ω(g.Keys("*")).Should(Equal([]string{"a"}))
+	})
+
+	It("should be inherited by Select", func() {
+		db, err := w.Select(1)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(db.Set("a", "1")).Should(Succeed())
+		Ω(db.Keys("*")).Should(Equal([]string{"a"}))
+		Ω(safe.Exists(prefix + "a")).Should(BeFalse())
+	})
+})
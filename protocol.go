@@ -0,0 +1,448 @@
+package wredis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Protocol sets the RESP protocol version in the Config. Version 3 negotiates
+// RESP3 with the HELLO command, falling back to RESP2 for servers which don't
+// support it (Redis < 6).
+//
+// With RESP3 replies are decoded as follows, in addition to the RESP2 types:
+//
+//	map             Map
+//	set             []interface{}
+//	double          float64
+//	boolean         bool
+//	big number      *big.Int
+//	verbatim string []byte, without the format prefix
+//	null            nil
+//	attribute       Attributed
+//	push            passed to the PushHandler; or []interface{} from Receive
+//
+// See: https://redis.io/commands/hello
+func Protocol(version int) Option {
+	return func(cfg Config) (Config, error) {
+		if version != 2 && version != 3 {
+			return cfg, errors.New("wredis: invalid protocol")
+		}
+		cfg.Protocol = version
+		return cfg, nil
+	}
+}
+
+// PushHandler sets the PushHandler in the Config. When using RESP3, it is
+// called with any push messages (e.g. client side caching invalidations)
+// received while waiting for a command's reply.
+func PushHandler(handler func([]interface{})) Option {
+	return func(cfg Config) (Config, error) {
+		cfg.PushHandler = handler
+		return cfg, nil
+	}
+}
+
+// dialNet dials the network connection for the configured Addr, performing
+// the TLS handshake if enabled.
+func (c Config) dialNet() (net.Conn, error) {
+	ctx := context.Background()
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.NetDialer != nil {
+		conn, err = c.NetDialer(ctx, c.Network, c.Addr())
+	} else {
+		d := net.Dialer{KeepAlive: 5 * time.Minute}
+		conn, err = d.DialContext(ctx, c.Network, c.Addr())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg, err := c.tlsConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsCfg == nil {
+		return conn, nil
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = c.Host
+	}
+	tlsConn := tls.Client(conn, tlsCfg)
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialResp dials a new connection, and with protocol 3 negotiates RESP3 using
+// HELLO. The connection is AUTH'd, as part of HELLO, or separately when using
+// (or falling back to) RESP2.
+func dialResp(cfg Config) (redis.Conn, error) {
+	netConn, err := cfg.dialNet()
+	if err != nil {
+		return nil, err
+	}
+	conn := newRespConn(netConn, cfg.PushHandler)
+
+	user, pass, err := cfg.credentials()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if cfg.Protocol != 3 {
+		if err = authWith(conn, user, pass); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	args := redis.Args{}.Add(3)
+	if pass != "" {
+		// HELLO requires a username, which AUTH otherwise defaults
+		helloUser := user
+		if helloUser == "" {
+			helloUser = "default"
+		}
+		args = args.Add("AUTH", helloUser, pass)
+	}
+	_, err = conn.Do("HELLO", args...)
+	if err == nil {
+		conn.proto = 3
+		return conn, nil
+	}
+
+	// older servers don't know HELLO, or RESP3
+	if !unsupportedHello(err) {
+		conn.Close()
+		return nil, err
+	}
+	if err = authWith(conn, user, pass); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// unsupportedHello returns true if the HELLO error means the server doesn't
+// support RESP3
+func unsupportedHello(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "NOPROTO") || strings.HasPrefix(msg, "ERR unknown command")
+}
+
+// respConn is a redis.Conn that speaks both RESP2 & RESP3.
+type respConn struct {
+	conn  net.Conn
+	proto int
+	push  func([]interface{})
+
+	mu  sync.Mutex
+	err error // fatal error, the connection can't be used
+
+	pending int // replies pending from Send
+	r       respReader
+	w       *respWriter
+}
+
+var _ redis.ConnWithTimeout = &respConn{}
+
+func newRespConn(conn net.Conn, push func([]interface{})) *respConn {
+	return &respConn{
+		conn:  conn,
+		proto: 2,
+		push:  push,
+		r:     respReader{br: bufio.NewReader(conn)},
+		w:     &respWriter{bw: bufio.NewWriter(conn)},
+	}
+}
+
+// fatal records an error that makes the connection unusable, and closes it.
+func (c *respConn) fatal(err error) error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	return err
+}
+
+// Close implements redis.Conn
+func (c *respConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil
+	}
+	c.err = errors.New("wredis: closed")
+	return c.conn.Close()
+}
+
+// Err implements redis.Conn
+func (c *respConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Send implements redis.Conn
+func (c *respConn) Send(cmd string, args ...interface{}) error {
+	return c.send(cmd, args, nil)
+}
+
+// sendCall sends the call, whose reply is read with receiveCall. It's the Send
+// equivalent for a respCall.
+func (c *respConn) sendCall(cmd string, call *respCall) error {
+	return c.send(cmd, nil, call)
+}
+
+// send writes the command, or the call if there is one
+func (c *respConn) send(cmd string, args []interface{}, call *respCall) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if call != nil {
+		c.w.writeStrings(cmd, call.args)
+	} else {
+		c.w.writeCommand(cmd, args)
+	}
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+	return nil
+}
+
+// Flush implements redis.Conn
+func (c *respConn) Flush() error {
+	if err := c.w.bw.Flush(); err != nil {
+		return c.fatal(err)
+	}
+	return nil
+}
+
+// Receive implements redis.Conn. Push messages are returned as replies, so
+// pub/sub works the same as it does with RESP2.
+func (c *respConn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *respConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.deadline(timeout); err != nil {
+		return nil, err
+	}
+	reply, _, err := c.r.readReply()
+	if err != nil {
+		return nil, c.fatal(err)
+	}
+	c.received()
+	if err, ok := reply.(redis.Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Do implements redis.Conn
+func (c *respConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, cmd, args...)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout. As with redigo, calling Do
+// with an empty command flushes any pending Send(s) and returns their replies.
+// A respCall passed as the only argument is sent as with call, see doCall.
+func (c *respConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if call := asCall(args); call != nil {
+		return nil, c.doCall(timeout, cmd, call)
+	}
+	return c.do(timeout, cmd, args, nil)
+}
+
+// call implements caller
+func (c *respConn) call(cmd string, call *respCall) error {
+	return c.doCall(0, cmd, call)
+}
+
+// doCall sends the call, and reads its reply into the call's buffers
+func (c *respConn) doCall(timeout time.Duration, cmd string, call *respCall) error {
+	_, err := c.do(timeout, cmd, nil, call)
+	return err
+}
+
+// do sends the command, or the call if there is one, and reads its reply
+func (c *respConn) do(timeout time.Duration, cmd string, args []interface{}, call *respCall) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = 0
+	c.mu.Unlock()
+	if cmd == "" && pending == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case call != nil:
+		c.w.writeStrings(cmd, call.args)
+	case cmd != "":
+		c.w.writeCommand(cmd, args)
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	if err := c.deadline(timeout); err != nil {
+		return nil, err
+	}
+
+	if cmd == "" {
+		replies := make([]interface{}, pending)
+		for i := range replies {
+			reply, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			replies[i] = reply
+		}
+		return replies, nil
+	}
+
+	if call != nil {
+		return nil, c.readCall(pending, call)
+	}
+
+	var (
+		reply interface{}
+		err   error
+	)
+	for i := 0; i <= pending; i++ {
+		var e error
+		if reply, e = c.readReply(); e != nil {
+			return nil, e
+		}
+		if e, ok := reply.(redis.Error); ok && err == nil {
+			err = e
+		}
+	}
+	return reply, err
+}
+
+// readReply reads the next reply, passing any push messages received in the
+// meantime to the push handler.
+func (c *respConn) readReply() (interface{}, error) {
+	for {
+		reply, push, err := c.r.readReply()
+		if err != nil {
+			return nil, c.fatal(err)
+		}
+		if !push {
+			return reply, nil
+		}
+		if c.push != nil {
+			c.push(reply.([]interface{}))
+		}
+	}
+}
+
+// readCall reads the replies to any pending Send(s), followed by the reply to
+// the call, which is read into the call's buffers. As with Do, the first error
+// reply is returned.
+func (c *respConn) readCall(pending int, call *respCall) error {
+	var err error
+	for i := 0; i < pending; i++ {
+		reply, e := c.readReply()
+		if e != nil {
+			return e
+		}
+		if e, ok := reply.(redis.Error); ok && err == nil {
+			err = e
+		}
+	}
+
+	// a fatal error takes precedence over any error reply
+	if e := c.readCallReply(call); err == nil || c.Err() != nil {
+		err = e
+	}
+	return err
+}
+
+// receiveCall reads the reply to a call previously sent with Send. It's the
+// Receive equivalent for a respCall.
+func (c *respConn) receiveCall(call *respCall) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if err := c.deadline(0); err != nil {
+		return err
+	}
+	err := c.readCallReply(call)
+	c.received()
+	return err
+}
+
+// readCallReply reads the reply into the call's buffers, passing any push
+// messages which arrive before it to the push handler.
+func (c *respConn) readCallReply(call *respCall) error {
+	for {
+		p, err := c.r.br.Peek(1)
+		if err != nil {
+			return c.fatal(err)
+		}
+		if p[0] != '>' {
+			break
+		}
+		push, _, err := c.r.readReply()
+		if err != nil {
+			return c.fatal(err)
+		}
+		if c.push != nil {
+			c.push(push.([]interface{}))
+		}
+	}
+
+	replyErr, err := call.read(c.r)
+	if err != nil {
+		return c.fatal(err)
+	}
+	return replyErr
+}
+
+// received records that a pending reply has been received
+func (c *respConn) received() {
+	c.mu.Lock()
+	if c.pending > 0 {
+		c.pending--
+	}
+	c.mu.Unlock()
+}
+
+// deadline sets the read deadline for the timeout, where 0 is no deadline
+func (c *respConn) deadline(timeout time.Duration) error {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if err := c.conn.SetReadDeadline(t); err != nil {
+		return c.fatal(err)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package wredis_test
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+
+	. "github.com/crowdriff/wredis"
+
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// do executes a raw command, returning its reply
+func do(w Wredis, cmd string, args ...interface{}) (interface{}, error) {
+	var reply interface{}
+	_, err := w.Int(func(conn redis.Conn) (int, error) {
+		var err error
+		reply, err = conn.Do(cmd, args...)
+		return 0, err
+	})
+	return reply, err
+}
+
+var _ = Describe("Protocol", func() {
+	It("should fail given an invalid protocol", func() {
+		_, err := Safe(Protocol(4))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid protocol"))
+	})
+
+	Context("RESP3", func() {
+		var (
+			server *fakeServer
+			w      Wredis
+		)
+
+		// replies with the raw RESP for the command named in the first arg
+		replies := map[string]string{
+			"MAP":      "%2\r\n$3\r\none\r\n:1\r\n+two\r\n$1\r\n2\r\n",
+			"SET":      "~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			"DOUBLE":   ",3.14\r\n",
+			"INF":      ",-inf\r\n",
+			"TRUE":     "#t\r\n",
+			"BIG":      "(3492890328409238509324850943850943825024385\r\n",
+			"VERBATIM": "=15\r\ntxt:Some string\r\n",
+			"NULL":     "_\r\n",
+			"ERROR":    "!21\r\nSYNTAX invalid syntax\r\n",
+			"ATTR":     "|1\r\n+ttl\r\n:3600\r\n$5\r\nvalue\r\n",
+			"PUSHED":   ">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n+OK\r\n",
+		}
+
+		BeforeEach(func() {
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("HELLO", func([]string) string {
+				return "%1\r\n$5\r\nproto\r\n:3\r\n"
+			})
+			server.Handle("RESP3", func(args []string) string {
+				return replies[args[1]]
+			})
+		})
+
+		AfterEach(func() {
+			if w != nil {
+				Ω(w.Close()).Should(Succeed())
+			}
+			Ω(server.Close()).Should(Succeed())
+		})
+
+		It("should negotiate RESP3 using HELLO with AUTH", func() {
+			var err error
+			w, err = Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				Password("secret"),
+				Protocol(3),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(server.Commands()[0]).Should(Equal([]string{"HELLO", "3", "AUTH", "default", "secret"}))
+		})
+
+		It("should fall back to RESP2 when HELLO is unknown", func() {
+			server.Handle("HELLO", func([]string) string {
+				return "-ERR unknown command 'HELLO'\r\n"
+			})
+
+			var err error
+			w, err = Safe(
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				Password("secret"),
+				Protocol(3),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(w.Ping()).Should(Equal("PONG"))
+			Ω(server.Commands()[1]).Should(Equal([]string{"AUTH", "secret"}))
+		})
+
+		It("should fail to connect when HELLO fails to AUTH", func() {
+			server.Handle("HELLO", func([]string) string {
+				return "-WRONGPASS invalid username-password pair\r\n"
+			})
+
+			var err error
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), Protocol(3))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = w.Ping()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("WRONGPASS"))
+		})
+
+		Context("decoding", func() {
+			var pushes [][]interface{}
+			var mu sync.Mutex
+
+			BeforeEach(func() {
+				pushes = nil
+
+				var err error
+				w, err = Safe(
+					Host("127.0.0.1"),
+					Port(server.Port()),
+					Protocol(3),
+					PushHandler(func(push []interface{}) {
+						mu.Lock()
+						defer mu.Unlock()
+						pushes = append(pushes, push)
+					}),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should decode maps", func() {
+				reply, err := do(w, "RESP3", "MAP")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(reply).Should(Equal(Map{"one": int64(1), "two": []byte("2")}))
+
+				Ω(StringMap(reply, err)).Should(Equal(map[string]string{"one": "1", "two": "2"}))
+			})
+
+			It("should decode sets as arrays", func() {
+				Ω(redis.Strings(do(w, "RESP3", "SET"))).Should(Equal([]string{"a", "b"}))
+			})
+
+			It("should decode doubles", func() {
+				Ω(Float64(do(w, "RESP3", "DOUBLE"))).Should(Equal(3.14))
+				Ω(Float64(do(w, "RESP3", "INF"))).Should(Equal(math.Inf(-1)))
+			})
+
+			It("should decode booleans", func() {
+				Ω(do(w, "RESP3", "TRUE")).Should(Equal(true))
+			})
+
+			It("should decode big numbers", func() {
+				n, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+				Ω(do(w, "RESP3", "BIG")).Should(Equal(n))
+			})
+
+			It("should decode verbatim strings without the format", func() {
+				Ω(redis.String(do(w, "RESP3", "VERBATIM"))).Should(Equal("Some string"))
+			})
+
+			It("should decode nulls", func() {
+				Ω(do(w, "RESP3", "NULL")).Should(BeNil())
+			})
+
+			It("should decode blob errors", func() {
+				_, err := do(w, "RESP3", "ERROR")
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(Equal("SYNTAX invalid syntax"))
+			})
+
+			It("should decode attributes", func() {
+				Ω(do(w, "RESP3", "ATTR")).Should(Equal(Attributed{
+					Attributes: Map{"ttl": int64(3600)},
+					Reply:      []byte("value"),
+				}))
+			})
+
+			It("should pass push messages to the handler", func() {
+				Ω(do(w, "RESP3", "PUSHED")).Should(Equal("OK"))
+
+				mu.Lock()
+				defer mu.Unlock()
+				Ω(pushes).Should(HaveLen(1))
+				Ω(redis.Strings(pushes[0][:1], nil)).Should(Equal([]string{"invalidate"}))
+			})
+
+			It("should read bulk strings into a buffer", func() {
+				server.Handle("GET", func(args []string) string {
+					return replies[args[1]]
+				})
+				Ω(w.Get("VERBATIM")).Should(Equal("Some string"))
+				Ω(w.GetBytes("ATTR", nil)).Should(Equal([]byte("value")))
+
+				_, err := w.Get("NULL")
+				Ω(err).Should(Equal(redis.ErrNil))
+
+				_, err = w.Get("ERROR")
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(Equal("SYNTAX invalid syntax"))
+
+				// the connection is still usable
+				Ω(w.Ping()).Should(Equal("PONG"))
+			})
+
+			It("should read push messages sent before a reply", func() {
+				server.Handle("GET", func([]string) string {
+					return ">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+				})
+				Ω(w.Get("key")).Should(Equal("value"))
+
+				mu.Lock()
+				defer mu.Unlock()
+				Ω(pushes).Should(HaveLen(1))
+			})
+
+			It("should read arrays into a string slice", func() {
+				server.Handle("MGET", func([]string) string {
+					return "*4\r\n$1\r\na\r\n$-1\r\n:3\r\n_\r\n"
+				})
+				Ω(w.MGetInto(make([]string, 0, 1), "a", "b", "c", "d")).Should(Equal([]string{"a", "", "3", ""}))
+			})
+
+			It("should pipeline commands", func() {
+				_, err := w.Int(func(conn redis.Conn) (int, error) {
+					Ω(conn.Send("RESP3", "TRUE")).Should(Succeed())
+					Ω(conn.Send("RESP3", "DOUBLE")).Should(Succeed())
+					Ω(conn.Flush()).Should(Succeed())
+					Ω(conn.Receive()).Should(Equal(true))
+					Ω(conn.Receive()).Should(Equal(3.14))
+					return 0, nil
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("Redis", func() {
+		var w Wredis
+
+		BeforeEach(func() {
+			var err error
+			w, err = Unsafe(Protocol(3))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(w.FlushAll()).Should(Succeed())
+			Ω(w.Close()).Should(Succeed())
+		})
+
+		It("should return HGETALL as a map", func() {
+			_, err := do(w, "HSET", "wredis::test::resp3", "a", "1", "b", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reply, err := do(w, "HGETALL", "wredis::test::resp3")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reply).Should(BeAssignableToTypeOf(Map{}))
+			Ω(StringMap(reply, err)).Should(Equal(map[string]string{"a": "1", "b": "2"}))
+		})
+
+		It("should run the regular commands", func() {
+			Ω(w.Set("wredis::test::resp3", "value")).Should(Succeed())
+			Ω(w.Get("wredis::test::resp3")).Should(Equal("value"))
+			Ω(w.SAdd("wredis::test::resp3::set", "a", "b")).Should(BeEquivalentTo(2))
+			members, err := w.SMembers("wredis::test::resp3::set")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(strings.Join(members, ",")).Should(SatisfyAny(Equal("a,b"), Equal("b,a")))
+		})
+	})
+})
@@ -0,0 +1,758 @@
+package wredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// the delays between attempts to reconnect a Subscription
+const (
+	resubscribeMinBackoff = 50 * time.Millisecond
+	resubscribeMaxBackoff = 5 * time.Second
+)
+
+// Message is a message received by a Subscription
+type Message struct {
+	Channel string
+	Pattern string // the pattern which matched the Channel, if PSubscribe'd
+	Data    []byte
+}
+
+// PubSubPing sets the PubSubPing in the Config: how often a Subscription PINGs
+// Redis to check its connection is alive. If no reply is received within two
+// intervals the connection is replaced, and resubscribed.
+func PubSubPing(interval time.Duration) Option {
+	return func(cfg Config) (Config, error) {
+		if interval <= 0 {
+			return cfg, errors.New("wredis: invalid pubsub ping")
+		}
+		cfg.PubSubPing = interval
+		return cfg, nil
+	}
+}
+
+// Publish posts the message to the channel, returning the number of clients
+// which received it.
+//
+// See: https://redis.io/commands/publish
+func (w *impl) Publish(channel, message string) (int64, error) {
+	if empty(channel) {
+		return int64Err("wredis: empty channel")
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("PUBLISH", channel, message))
+	})
+}
+
+// Subscribe subscribes to the channels, returning a Subscription which
+// receives their messages until it's closed, or the context is done.
+//
+// See: https://redis.io/commands/subscribe
+func (w *impl) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	if len(channels) == 0 {
+		return nil, errors.New("wredis: no channels")
+	}
+	if any(channels, empty) {
+		return nil, errors.New("wredis: empty channels")
+	}
+	return w.subscribe(ctx, channels, nil, false)
+}
+
+// PSubscribe subscribes to the channels matching the patterns, returning a
+// Subscription which receives their messages until it's closed, or the
+// context is done.
+//
+// See: https://redis.io/commands/psubscribe
+func (w *impl) PSubscribe(ctx context.Context, patterns ...string) (*Subscription, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("wredis: no patterns")
+	}
+	if any(patterns, empty) {
+		return nil, errors.New("wredis: empty patterns")
+	}
+	return w.subscribe(ctx, nil, patterns, false)
+}
+
+// SSubscribe subscribes to the sharded channels, returning a Subscription
+// which receives their messages until it's closed, or the context is done.
+//
+// In Cluster mode the channels are routed by their slots, so the Subscription
+// holds a connection to each node serving any of them. When a slot migrates,
+// the node unsubscribes us from its channels (or replies MOVED), and they're
+// resubscribed on the node now serving them, once the slots are rediscovered
+// using CLUSTER SLOTS. Messages published during the migration are lost.
+//
+// See: https://redis.io/commands/ssubscribe
+func (w *impl) SSubscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	if len(channels) == 0 {
+		return nil, errors.New("wredis: no channels")
+	}
+	if any(channels, empty) {
+		return nil, errors.New("wredis: empty channels")
+	}
+	if !w.cfg.Cluster {
+		return w.subscribe(ctx, channels, nil, true)
+	}
+
+	if atomic.LoadInt32(&w.closing) == 1 {
+		return nil, ErrClosed
+	}
+	s := w.newSubscription(ctx, channels, nil)
+	s.sharded = true
+	s.shards = make(map[string]*Subscription)
+	if err := s.route(channels, true); err != nil {
+		s.cancel()
+		s.runShards()
+		return nil, err
+	}
+	if err := w.register(s); err != nil {
+		s.cancel()
+		s.runShards()
+		return nil, err
+	}
+	go s.runShards()
+	return s, nil
+}
+
+// subscribe connects a new Subscription, and starts receiving its messages
+func (w *impl) subscribe(ctx context.Context, channels, patterns []string, sharded bool) (*Subscription, error) {
+	if atomic.LoadInt32(&w.closing) == 1 {
+		return nil, ErrClosed
+	}
+
+	s := w.newSubscription(ctx, channels, patterns)
+	s.sharded = sharded
+	conn, err := s.connect()
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	if err = w.register(s); err != nil {
+		conn.Close()
+		s.cancel()
+		return nil, err
+	}
+
+	go s.run(conn)
+	go s.ping()
+	return s, nil
+}
+
+// register adds the Subscription to those closed along with the Wredis
+func (w *impl) register(s *Subscription) error {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	if w.subs == nil {
+		return ErrClosed
+	}
+	w.subs[s] = struct{}{}
+	return nil
+}
+
+// newSubscription returns a Subscription to the channels and patterns, which
+// isn't yet connected
+func (w *impl) newSubscription(ctx context.Context, channels, patterns []string) *Subscription {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{
+		w:        w,
+		ctx:      ctx,
+		cancel:   cancel,
+		messages: make(chan Message, 128),
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	for _, channel := range channels {
+		s.channels[channel] = true
+	}
+	for _, pattern := range patterns {
+		s.patterns[pattern] = true
+	}
+	return s
+}
+
+// Subscription is a connection subscribed to channels, or patterns, whose
+// messages are received from Messages. It PINGs Redis to check its connection
+// is alive, and reconnects and resubscribes if it fails.
+//
+// Subscriptions use a connection of their own, rather than one from the pool;
+// and always use RESP2. They're closed by Close, when their context is done,
+// or when the Wredis is closed. A subscribed RESP2 connection can't AUTH, so
+// with Credentials it's reconnected, with fresh credentials, once the refresh
+// has elapsed; messages published while reconnecting are lost.
+//
+// They're built on redigo's PubSubConn, except for sharded channels: it
+// doesn't know SSUBSCRIBE, or the smessage & sunsubscribe replies, so those
+// are sent, and received into PubSubConn's types, by receiveSharded.
+type Subscription struct {
+	w        *impl
+	ctx      context.Context
+	cancel   context.CancelFunc
+	messages chan Message
+	done     chan struct{} // closed once run returns
+	once     sync.Once
+
+	sharded bool          // subscribed using SSUBSCRIBE, see SSubscribe
+	addr    string        // the node a shard connects to, see Config.node
+	parent  *Subscription // the sharded Subscription a shard belongs to
+
+	mu       sync.Mutex
+	conn     redis.Conn // the current connection, nil while reconnecting
+	authed   time.Time  // when conn was dialed, and so AUTH'd
+	channels map[string]bool
+	patterns map[string]bool
+	shards   map[string]*Subscription // by node, if sharded in Cluster mode
+}
+
+// Messages returns the channel the messages are received on, it's closed once
+// the Subscription is closed.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Subscribe subscribes to more channels.
+func (s *Subscription) Subscribe(channels ...string) error {
+	if s.shards != nil {
+		return s.subscribeShards(channels)
+	}
+	return s.update(channels, s.channels, true, s.command("SUBSCRIBE"))
+}
+
+// Unsubscribe unsubscribes from the channels.
+func (s *Subscription) Unsubscribe(channels ...string) error {
+	if s.shards != nil {
+		return s.unsubscribeShards(channels)
+	}
+	return s.update(channels, s.channels, false, s.command("UNSUBSCRIBE"))
+}
+
+// PSubscribe subscribes to more patterns. A sharded Subscription can't
+// subscribe to patterns.
+func (s *Subscription) PSubscribe(patterns ...string) error {
+	if s.sharded {
+		return errors.New("wredis: sharded subscriptions have no patterns")
+	}
+	return s.update(patterns, s.patterns, true, "PSUBSCRIBE")
+}
+
+// PUnsubscribe unsubscribes from the patterns.
+func (s *Subscription) PUnsubscribe(patterns ...string) error {
+	if s.sharded {
+		return errors.New("wredis: sharded subscriptions have no patterns")
+	}
+	return s.update(patterns, s.patterns, false, "PUNSUBSCRIBE")
+}
+
+// command returns the sharded form of the (UN)SUBSCRIBE command, if sharded
+func (s *Subscription) command(cmd string) string {
+	if s.sharded {
+		return "S" + cmd
+	}
+	return cmd
+}
+
+// update adds, or removes, the names and (un)subscribes from them. If we're
+// reconnecting, they're (un)subscribed once connected.
+func (s *Subscription) update(names []string, set map[string]bool, add bool, cmd string) error {
+	if len(names) == 0 {
+		return errors.New("wredis: no channels")
+	}
+	if any(names, empty) {
+		return errors.New("wredis: empty channels")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+	}
+
+	for _, name := range names {
+		if add {
+			set[name] = true
+		} else {
+			delete(set, name)
+		}
+	}
+	if s.conn == nil {
+		return nil
+	}
+	return s.send(s.conn, cmd, names)
+}
+
+// send sends the (un)subscribe command for the names, using the PubSubConn's
+// methods. In Cluster mode sharded channels, which PubSubConn doesn't support,
+// are sent a slot at a time, as they must all share the slot.
+func (s *Subscription) send(conn redis.Conn, cmd string, names []string) error {
+	psc := redis.PubSubConn{Conn: conn}
+	args := redis.Args{}.AddFlat(names)
+	switch cmd {
+	case "SUBSCRIBE":
+		return psc.Subscribe(args...)
+	case "UNSUBSCRIBE":
+		return psc.Unsubscribe(args...)
+	case "PSUBSCRIBE":
+		return psc.PSubscribe(args...)
+	case "PUNSUBSCRIBE":
+		return psc.PUnsubscribe(args...)
+	}
+
+	groups := [][]string{names}
+	if s.sharded && s.w.cfg.Cluster {
+		groups = groups[:0]
+		slots := make(map[int]int)
+		for _, name := range names {
+			slot := hashSlot(name)
+			if i, ok := slots[slot]; ok {
+				groups[i] = append(groups[i], name)
+				continue
+			}
+			slots[slot] = len(groups)
+			groups = append(groups, []string{name})
+		}
+	}
+	for _, group := range groups {
+		if err := conn.Send(cmd, redis.Args{}.AddFlat(group)...); err != nil {
+			return err
+		}
+	}
+	return conn.Flush()
+}
+
+// Close unsubscribes, closing the connection and the Messages channel.
+func (s *Subscription) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.mu.Unlock()
+		<-s.done
+
+		s.w.subsMu.Lock()
+		delete(s.w.subs, s)
+		s.w.subsMu.Unlock()
+	})
+	return nil
+}
+
+// connect dials a connection, and subscribes to the channels and patterns
+func (s *Subscription) connect() (redis.Conn, error) {
+	cfg, err := s.w.cfg.node(s.addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Protocol = 2
+	conn, err := cfg.Dialer(cfg)()
+	if err != nil {
+		return nil, err
+	}
+	conn = s.w.wrap(conn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.channels) > 0 {
+		if err = s.send(conn, s.command("SUBSCRIBE"), members(s.channels)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if len(s.patterns) > 0 {
+		if err = s.send(conn, "PSUBSCRIBE", members(s.patterns)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	s.conn = conn
+	s.authed = time.Now()
+	return conn, nil
+}
+
+// run receives the messages, until the context is done; reconnecting if the
+// connection fails, or connecting if it's nil.
+func (s *Subscription) run(conn redis.Conn) {
+	defer close(s.done)
+	// the shards of a sharded Subscription share its Messages
+	if s.parent == nil {
+		defer close(s.messages)
+	}
+
+	backoff := resubscribeMinBackoff
+	for {
+		if conn != nil {
+			s.receive(conn)
+			conn.Close()
+			s.mu.Lock()
+			s.conn = nil
+			s.mu.Unlock()
+		}
+
+		// reconnect, and resubscribe, backing off between attempts
+		var err error
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > resubscribeMaxBackoff {
+				backoff = resubscribeMaxBackoff
+			}
+			if conn, err = s.connect(); err == nil {
+				break
+			}
+		}
+		backoff = resubscribeMinBackoff
+		if s.ctx.Err() != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// receive receives the messages from the connection, until it fails. While
+// subscribed it's PINGed, so it times out if nothing is received for two
+// intervals.
+func (s *Subscription) receive(conn redis.Conn) error {
+	psc := redis.PubSubConn{Conn: conn}
+	for {
+		var timeout time.Duration
+		if s.subscribed() {
+			timeout = 2 * s.w.cfg.PubSubPing
+		}
+
+		var reply interface{}
+		if s.sharded {
+			reply = receiveSharded(conn, timeout)
+		} else {
+			reply = psc.ReceiveWithTimeout(timeout)
+		}
+
+		var msg Message
+		switch reply := reply.(type) {
+		case redis.Message:
+			msg = Message{Channel: reply.Channel, Data: reply.Data}
+		case redis.PMessage:
+			msg = Message{Pattern: reply.Pattern, Channel: reply.Channel, Data: reply.Data}
+		case redis.Subscription:
+			// Redis unsubscribes us from the channels of a slot it no longer
+			// serves, e.g. once it's migrated to another node
+			if reply.Kind == "sunsubscribe" && s.parent != nil {
+				s.moved(reply.Channel)
+			}
+			continue
+		case error:
+			if slot, ok := movedSlot(reply); ok && s.parent != nil {
+				// we subscribed to a channel whose slot another node serves
+				s.moved(s.slotChannels(slot)...)
+				continue
+			}
+			return reply
+		default:
+			continue
+		}
+		if err := s.deliver(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveSharded is PubSubConn.ReceiveWithTimeout for sharded channels, whose
+// smessage, ssubscribe & sunsubscribe replies PubSubConn doesn't know.
+func receiveSharded(conn redis.Conn, timeout time.Duration) interface{} {
+	values, err := redis.Values(redis.ReceiveWithTimeout(conn, timeout))
+	if err != nil {
+		return err
+	}
+	var kind string
+	if values, err = redis.Scan(values, &kind); err != nil {
+		return err
+	}
+
+	switch kind {
+	case "smessage":
+		var msg redis.Message
+		if _, err = redis.Scan(values, &msg.Channel, &msg.Data); err != nil {
+			return err
+		}
+		return msg
+	case "ssubscribe", "sunsubscribe":
+		sub := redis.Subscription{Kind: kind}
+		if _, err = redis.Scan(values, &sub.Channel, &sub.Count); err != nil {
+			return err
+		}
+		return sub
+	case "pong":
+		var pong redis.Pong
+		if _, err = redis.Scan(values, &pong.Data); err != nil {
+			return err
+		}
+		return pong
+	}
+	return fmt.Errorf("wredis: unknown pubsub notification %q", kind)
+}
+
+// deliver sends the message on the Messages channel, unless the context is
+// done first
+func (s *Subscription) deliver(msg Message) error {
+	select {
+	case s.messages <- msg:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// subscribed returns true if there are any channels, or patterns
+func (s *Subscription) subscribed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels)+len(s.patterns) > 0
+}
+
+// ping PINGs Redis, while subscribed, so that a dead connection times out;
+// closes the connection once its credentials are due to be refreshed, so it's
+// reconnected; and closes the Subscription once the context is done.
+func (s *Subscription) ping() {
+	cfg := s.w.cfg
+	interval := cfg.PubSubPing
+	if cfg.reauthenticates() && cfg.CredentialsRefresh < interval {
+		interval = cfg.CredentialsRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.Close()
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		switch {
+		case s.conn == nil:
+		case cfg.reauthenticates() && time.Since(s.authed) >= cfg.CredentialsRefresh:
+			s.conn.Close()
+		case len(s.channels)+len(s.patterns) > 0:
+			// a connection which isn't subscribed can't PING
+			redis.PubSubConn{Conn: s.conn}.Ping("")
+		}
+		s.mu.Unlock()
+	}
+}
+
+// route subscribes the shards, for the nodes serving their slots, to the
+// channels; starting a shard for any node without one. If connect, the new
+// shards are connected before returning, otherwise they connect in the
+// background.
+func (s *Subscription) route(channels []string, connect bool) error {
+	nodes := make(map[string][]string)
+	for _, channel := range channels {
+		slot := hashSlot(channel)
+		addr, ok := s.w.slots.node(slot)
+		if !ok {
+			if err := s.w.slots.refresh(s.w); err != nil {
+				return err
+			}
+			if addr, ok = s.w.slots.node(slot); !ok {
+				return fmt.Errorf("wredis: no node serves slot %d", slot)
+			}
+		}
+		nodes[addr] = append(nodes[addr], channel)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return ErrClosed
+	}
+	for addr, names := range nodes {
+		if shard, ok := s.shards[addr]; ok {
+			if err := shard.Subscribe(names...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		shard := s.w.newSubscription(s.ctx, names, nil)
+		shard.sharded = true
+		shard.addr = addr
+		shard.parent = s
+		shard.messages = s.messages
+		var conn redis.Conn
+		if connect {
+			var err error
+			if conn, err = shard.connect(); err != nil {
+				shard.cancel()
+				return err
+			}
+		}
+		s.shards[addr] = shard
+		go shard.run(conn)
+		go shard.ping()
+	}
+	return nil
+}
+
+// subscribeShards adds the channels, and routes them to the shards
+func (s *Subscription) subscribeShards(channels []string) error {
+	if len(channels) == 0 {
+		return errors.New("wredis: no channels")
+	}
+	if any(channels, empty) {
+		return errors.New("wredis: empty channels")
+	}
+	s.mu.Lock()
+	for _, channel := range channels {
+		s.channels[channel] = true
+	}
+	s.mu.Unlock()
+	return s.route(channels, false)
+}
+
+// unsubscribeShards removes the channels, unsubscribing the shards from them
+func (s *Subscription) unsubscribeShards(channels []string) error {
+	if len(channels) == 0 {
+		return errors.New("wredis: no channels")
+	}
+	if any(channels, empty) {
+		return errors.New("wredis: empty channels")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return ErrClosed
+	}
+	for _, channel := range channels {
+		delete(s.channels, channel)
+	}
+	for _, shard := range s.shards {
+		if names := shard.subscribedTo(channels); len(names) > 0 {
+			if err := shard.Unsubscribe(names...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// subscribedTo returns those of the channels the Subscription is subscribed to
+func (s *Subscription) subscribedTo(channels []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, channel := range channels {
+		if s.channels[channel] {
+			names = append(names, channel)
+		}
+	}
+	return names
+}
+
+// slotChannels returns the channels of the Subscription in the slot
+func (s *Subscription) slotChannels(slot int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for channel := range s.channels {
+		if hashSlot(channel) == slot {
+			names = append(names, channel)
+		}
+	}
+	return names
+}
+
+// moved removes the channels, whose slots another node now serves, from the
+// shard; and has its parent migrate them to the node serving them
+func (s *Subscription) moved(channels ...string) {
+	s.mu.Lock()
+	var moved []string
+	for _, channel := range channels {
+		if s.channels[channel] {
+			delete(s.channels, channel)
+			moved = append(moved, channel)
+		}
+	}
+	s.mu.Unlock()
+	if len(moved) > 0 {
+		go s.parent.migrate(moved)
+	}
+}
+
+// migrate rediscovers the slots, and routes the channels (which are still
+// subscribed to) to the shards for the nodes now serving them; backing off
+// between attempts until it succeeds, or the context is done
+func (s *Subscription) migrate(channels []string) {
+	backoff := resubscribeMinBackoff
+	for {
+		err := s.w.slots.refresh(s.w)
+		if err == nil {
+			if channels = s.subscribedTo(channels); len(channels) == 0 {
+				return
+			}
+			if err = s.route(channels, false); err == nil || err == ErrClosed {
+				return
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > resubscribeMaxBackoff {
+			backoff = resubscribeMaxBackoff
+		}
+	}
+}
+
+// runShards waits for the context of a sharded Subscription to be done, then
+// closes its shards before closing the Messages channel they share
+func (s *Subscription) runShards() {
+	<-s.ctx.Done()
+	s.mu.Lock()
+	shards := make([]*Subscription, 0, len(s.shards))
+	for addr, shard := range s.shards {
+		shards = append(shards, shard)
+		delete(s.shards, addr)
+	}
+	s.mu.Unlock()
+
+	for _, shard := range shards {
+		shard.Close()
+	}
+	close(s.messages)
+	close(s.done)
+	s.Close()
+}
+
+// closeSubscriptions closes the Subscriptions, and prevents new ones
+func (w *impl) closeSubscriptions() {
+	w.subsMu.Lock()
+	subs := w.subs
+	w.subs = nil
+	w.subsMu.Unlock()
+	for s := range subs {
+		s.Close()
+	}
+}
+
+// members returns the members of the set
+func members(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
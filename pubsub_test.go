@@ -0,0 +1,464 @@
+package wredis_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PubSub", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// publish publishes the message once it has a subscriber
+	publish := func(channel, msg string) {
+		Eventually(func() (int64, error) {
+			return safe.Publish(channel, msg)
+		}).Should(BeEquivalentTo(1))
+	}
+
+	It("should fail given invalid channels", func() {
+		_, err := safe.Publish("", "msg")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty channel"))
+
+		_, err = safe.Subscribe(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: no channels"))
+
+		_, err = safe.PSubscribe(ctx, "")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty patterns"))
+
+	})
+
+	It("should receive the messages published to its channels", func() {
+		sub, err := safe.Subscribe(ctx, "wredis::test::a")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer sub.Close()
+
+		publish("wredis::test::a", "hello")
+		var msg Message
+		Eventually(sub.Messages()).Should(Receive(&msg))
+		Ω(msg.Channel).Should(Equal("wredis::test::a"))
+		Ω(msg.Pattern).Should(BeEmpty())
+		Ω(string(msg.Data)).Should(Equal("hello"))
+	})
+
+	It("should receive the messages published to channels matching its patterns", func() {
+		sub, err := safe.PSubscribe(ctx, "wredis::test::*")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer sub.Close()
+
+		publish("wredis::test::b", "hello")
+		var msg Message
+		Eventually(sub.Messages()).Should(Receive(&msg))
+		Ω(msg.Channel).Should(Equal("wredis::test::b"))
+		Ω(msg.Pattern).Should(Equal("wredis::test::*"))
+	})
+
+	It("should add and remove channels", func() {
+		sub, err := safe.Subscribe(ctx, "wredis::test::a")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer sub.Close()
+
+		Ω(sub.Subscribe("wredis::test::b")).Should(Succeed())
+		publish("wredis::test::b", "hello")
+		Eventually(sub.Messages()).Should(Receive())
+
+		Ω(sub.Unsubscribe("wredis::test::a")).Should(Succeed())
+		Eventually(func() (int64, error) {
+			return safe.Publish("wredis::test::a", "hello")
+		}).Should(BeZero())
+
+		Ω(sub.PSubscribe("wredis::test::c*")).Should(Succeed())
+		publish("wredis::test::cc", "hello")
+		Eventually(sub.Messages()).Should(Receive())
+		Ω(sub.PUnsubscribe("wredis::test::c*")).Should(Succeed())
+	})
+
+	It("should close the Messages channel once closed", func() {
+		sub, err := safe.Subscribe(ctx, "wredis::test::a")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sub.Close()).Should(Succeed())
+		Eventually(sub.Messages()).Should(BeClosed())
+		Ω(sub.Subscribe("wredis::test::b")).Should(Equal(ErrClosed))
+	})
+
+	It("should close once the context is done", func() {
+		sub, err := safe.Subscribe(ctx, "wredis::test::a")
+		Ω(err).ShouldNot(HaveOccurred())
+		cancel()
+		Eventually(sub.Messages()).Should(BeClosed())
+	})
+
+	It("should be closed with the Wredis", func() {
+		w, err := Safe()
+		Ω(err).ShouldNot(HaveOccurred())
+		sub, err := w.Subscribe(ctx, "wredis::test::a")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(w.Close()).Should(Succeed())
+		Eventually(sub.Messages()).Should(BeClosed())
+		_, err = w.Subscribe(ctx, "wredis::test::a")
+		Ω(err).Should(Equal(ErrClosed))
+	})
+
+	Context("connection failures", func() {
+		var (
+			mu    sync.Mutex
+			conns []net.Conn
+			dials int32
+		)
+
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err == nil {
+				mu.Lock()
+				conns = append(conns, conn)
+				mu.Unlock()
+			}
+			return conn, err
+		}
+
+		BeforeEach(func() {
+			conns = nil
+			atomic.StoreInt32(&dials, 0)
+		})
+
+		It("should reconnect and resubscribe", func() {
+			w, err := Safe(NetDialer(dial))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			sub, err := w.Subscribe(ctx, "wredis::test::a")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer sub.Close()
+			Ω(sub.PSubscribe("wredis::test::p*")).Should(Succeed())
+			publish("wredis::test::a", "before")
+			Eventually(sub.Messages()).Should(Receive())
+
+			// drop the subscription's connection
+			mu.Lock()
+			for _, conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+
+			// Redis may not have noticed the dropped connection yet, so keep
+			// publishing until the resubscribed connection receives it
+			received := func(channel, pattern string) func() bool {
+				return func() bool {
+					safe.Publish(channel, "after")
+					select {
+					case msg := <-sub.Messages():
+						return string(msg.Data) == "after" && msg.Pattern == pattern
+					case <-time.After(10 * time.Millisecond):
+						return false
+					}
+				}
+			}
+			Eventually(received("wredis::test::a", "")).Should(BeTrue())
+			Eventually(received("wredis::test::pp", "wredis::test::p*")).Should(BeTrue())
+			Ω(atomic.LoadInt32(&dials)).Should(BeNumerically(">=", 2))
+		})
+
+		It("should reconnect when PINGs aren't answered", func() {
+			server, err := newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer server.Close()
+			server.Handle("SUBSCRIBE", func(args []string) string {
+				return "*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n"
+			})
+			server.Handle("PING", func([]string) string { return "" })
+
+			w, err := Safe(Host("127.0.0.1"), Port(server.Port()), NetDialer(dial), PubSubPing(20*time.Millisecond))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			sub, err := w.Subscribe(ctx, "a")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer sub.Close()
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&dials)
+			}).Should(BeNumerically(">=", 2))
+		})
+	})
+})
+
+var _ = Describe("Sharded PubSub", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// bulk returns the RESP bulk string
+	bulk := func(s string) string {
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	}
+
+	// push returns a RESP2 pub/sub push of the kind for the channel
+	push := func(kind, channel, data string) string {
+		return "*3\r\n" + bulk(kind) + bulk(channel) + bulk(data)
+	}
+
+	// subscribed replies to SSUBSCRIBE, and pushes a message from the node to
+	// each of the channels
+	subscribed := func(node string) fakeHandler {
+		return func(args []string) string {
+			reply := ""
+			for i, channel := range args[1:] {
+				reply += fmt.Sprintf("*3\r\n%s%s:%d\r\n", bulk("ssubscribe"), bulk(channel), i+1)
+				reply += push("smessage", channel, node)
+			}
+			return reply
+		}
+	}
+
+	// slots returns a CLUSTER SLOTS reply, of the nodes serving the ranges
+	slots := func(ranges ...interface{}) string {
+		reply := fmt.Sprintf("*%d\r\n", len(ranges)/3)
+		for i := 0; i < len(ranges); i += 3 {
+			reply += fmt.Sprintf("*3\r\n:%d\r\n:%d\r\n*2\r\n%s:%d\r\n",
+				ranges[i], ranges[i+1], bulk("127.0.0.1"), ranges[i+2])
+		}
+		return reply
+	}
+
+	It("should hash keys to their cluster slots", func() {
+		Ω(HashSlot("123456789")).Should(Equal(12739))
+		Ω(HashSlot("foo")).Should(Equal(12182))
+		Ω(HashSlot("bar")).Should(Equal(5061))
+		Ω(HashSlot("{user1000}.following")).Should(Equal(HashSlot("{user1000}.followers")))
+		Ω(HashSlot("foo{}{bar}")).ShouldNot(Equal(HashSlot("bar")))
+		Ω(HashSlot("foo{{bar}}")).Should(Equal(HashSlot("{bar")))
+	})
+
+	It("should fail given invalid channels", func() {
+		_, err := safe.SPublish("", "msg")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty channel"))
+
+		_, err = safe.SSubscribe(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: no channels"))
+
+		_, err = safe.SSubscribe(ctx, "a", " ")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: empty channels"))
+	})
+
+	It("should reconnect with fresh credentials once the refresh has elapsed", func() {
+		server, err := newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer server.Close()
+		server.Handle("SUBSCRIBE", func(args []string) string {
+			return fmt.Sprintf("*3\r\n%s%s:1\r\n", bulk("subscribe"), bulk(args[1])) +
+				push("message", args[1], "hello")
+		})
+
+		var tokens int32
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			Credentials(func(context.Context) (string, string, error) {
+				return "", fmt.Sprintf("token-%d", atomic.AddInt32(&tokens, 1)), nil
+			}, 100*time.Millisecond),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		sub, err := w.Subscribe(ctx, "a")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer sub.Close()
+		Eventually(sub.Messages()).Should(Receive())
+
+		// resubscribed over a connection AUTH'd with the next token
+		Eventually(sub.Messages(), time.Second).Should(Receive())
+		Ω(server.Commands()).Should(ContainElement([]string{"AUTH", "token-2"}))
+		Ω(server.Commands()).Should(ContainElement([]string{"SUBSCRIBE", "a"}))
+	})
+
+	It("should publish and subscribe to a single node", func() {
+		server, err := newFakeServer(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer server.Close()
+		server.Handle("SPUBLISH", func([]string) string { return ":1\r\n" })
+		server.Handle("SSUBSCRIBE", subscribed("node"))
+
+		w, err := Safe(Host("127.0.0.1"), Port(server.Port()))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.SPublish("a", "hello")).Should(BeEquivalentTo(1))
+		sub, err := w.SSubscribe(ctx, "a")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer sub.Close()
+
+		var msg Message
+		Eventually(sub.Messages()).Should(Receive(&msg))
+		Ω(msg).Should(Equal(Message{Channel: "a", Data: []byte("node")}))
+		Ω(sub.PSubscribe("a*")).Should(MatchError("wredis: sharded subscriptions have no patterns"))
+	})
+
+	Context("in Cluster mode", func() {
+		var a, b *fakeServer
+
+		BeforeEach(func() {
+			var err error
+			a, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			b, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			// "bar" is in slot 5061, served by a; and "foo" in slot 12182 by b
+			split := slots(0, 8191, a.Port(), 8192, 16383, b.Port())
+			a.Handle("CLUSTER", func([]string) string { return split })
+			a.Handle("SPUBLISH", func([]string) string { return ":1\r\n" })
+			b.Handle("SPUBLISH", func([]string) string { return ":2\r\n" })
+			a.Handle("SSUBSCRIBE", subscribed("a"))
+			b.Handle("SSUBSCRIBE", subscribed("b"))
+		})
+
+		AfterEach(func() {
+			a.Close()
+			b.Close()
+		})
+
+		cluster := func() Wredis {
+			w, err := Safe(Host("127.0.0.1"), Port(a.Port()), Cluster(true))
+			Ω(err).ShouldNot(HaveOccurred())
+			return w
+		}
+
+		It("should publish to the node serving the channel's slot", func() {
+			w := cluster()
+			defer w.Close()
+
+			Ω(w.SPublish("bar", "hello")).Should(BeEquivalentTo(1))
+			Ω(w.SPublish("foo", "hello")).Should(BeEquivalentTo(2))
+			Ω(b.Commands()).Should(ContainElement([]string{"SPUBLISH", "foo", "hello"}))
+			Ω(a.Commands()).ShouldNot(ContainElement([]string{"SPUBLISH", "foo", "hello"}))
+		})
+
+		It("should rediscover the slots when MOVED", func() {
+			var moved int32
+			a.Handle("CLUSTER", func([]string) string {
+				if atomic.LoadInt32(&moved) == 1 {
+					return slots(0, 8191, a.Port(), 8192, 16383, b.Port())
+				}
+				return slots(0, 16383, a.Port())
+			})
+			a.Handle("SPUBLISH", func(args []string) string {
+				atomic.StoreInt32(&moved, 1)
+				return fmt.Sprintf("-MOVED %d 127.0.0.1:%d\r\n", HashSlot(args[1]), b.Port())
+			})
+
+			w := cluster()
+			defer w.Close()
+			Ω(w.SPublish("foo", "hello")).Should(BeEquivalentTo(2))
+		})
+
+		It("should subscribe on the nodes serving the channels' slots", func() {
+			w := cluster()
+			defer w.Close()
+
+			sub, err := w.SSubscribe(ctx, "foo", "bar")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer sub.Close()
+
+			received := map[string]string{}
+			for i := 0; i < 2; i++ {
+				var msg Message
+				Eventually(sub.Messages()).Should(Receive(&msg))
+				received[msg.Channel] = string(msg.Data)
+			}
+			Ω(received).Should(Equal(map[string]string{"foo": "b", "bar": "a"}))
+			Ω(sub.PSubscribe("f*")).Should(HaveOccurred())
+		})
+
+		It("should resubscribe to channels whose slot migrates", func() {
+			var moved int32
+			a.Handle("CLUSTER", func([]string) string {
+				if atomic.LoadInt32(&moved) == 1 {
+					return slots(0, 16383, a.Port())
+				}
+				return slots(0, 8191, a.Port(), 8192, 16383, b.Port())
+			})
+			// b unsubscribes us from "foo", as its slot migrates to a
+			b.Handle("SSUBSCRIBE", func(args []string) string {
+				atomic.StoreInt32(&moved, 1)
+				return fmt.Sprintf("*3\r\n%s%s:1\r\n", bulk("ssubscribe"), bulk(args[1])) +
+					fmt.Sprintf("*3\r\n%s%s:0\r\n", bulk("sunsubscribe"), bulk(args[1]))
+			})
+
+			w := cluster()
+			defer w.Close()
+			sub, err := w.SSubscribe(ctx, "foo")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer sub.Close()
+
+			var msg Message
+			Eventually(sub.Messages()).Should(Receive(&msg))
+			Ω(msg).Should(Equal(Message{Channel: "foo", Data: []byte("a")}))
+		})
+
+		It("should add and remove channels", func() {
+			w := cluster()
+			defer w.Close()
+			sub, err := w.SSubscribe(ctx, "bar")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer sub.Close()
+			Eventually(sub.Messages()).Should(Receive())
+
+			Ω(sub.Subscribe("foo")).Should(Succeed())
+			var msg Message
+			Eventually(sub.Messages()).Should(Receive(&msg))
+			Ω(msg).Should(Equal(Message{Channel: "foo", Data: []byte("b")}))
+
+			b.Handle("SUNSUBSCRIBE", func(args []string) string {
+				return fmt.Sprintf("*3\r\n%s%s:0\r\n", bulk("sunsubscribe"), bulk(args[1]))
+			})
+			Ω(sub.Unsubscribe("foo")).Should(Succeed())
+			Eventually(b.Commands).Should(ContainElement([]string{"SUNSUBSCRIBE", "foo"}))
+		})
+
+		It("should close the shards once the context is done", func() {
+			w := cluster()
+			defer w.Close()
+			sub, err := w.SSubscribe(ctx, "foo", "bar")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			cancel()
+			Eventually(sub.Messages()).Should(BeClosed())
+			Ω(sub.Subscribe("baz")).Should(Equal(ErrClosed))
+		})
+	})
+})
@@ -0,0 +1,323 @@
+package wredis
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrReadOnly is returned, without sending the command, when a read only
+// Wredis is asked to write.
+var ErrReadOnly = errors.New("wredis: read only")
+
+// ReadOnly sets the ReadOnly value in the Config. A read only Wredis returns
+// ErrReadOnly for every command which may write, including those sent using
+// Do. Commands wredis doesn't know to be reads or writes are classified using
+// the flags from Redis' COMMAND INFO; if that fails, they're treated as writes.
+func ReadOnly(readOnly bool) Option {
+	return func(cfg Config) (Config, error) {
+		cfg.ReadOnly = readOnly
+		return cfg, nil
+	}
+}
+
+// writes returns true if the command may write
+func (w *impl) writes(cmd string, args []interface{}) bool {
+	cats := categoriesOf(cmd, args)
+	switch {
+	case cats&(catWrite|catDangerous) != 0:
+		return true
+	case cats&(catRead|catConnection|catTransaction|catPubSub) != 0:
+		return false
+	}
+
+	server, err := w.server.command(w, cmd, args)
+	if err != nil {
+		return true
+	}
+	return server != nil && server.cats&catWrite != 0
+}
+
+// classification is what's known of a command being sent
+type classification struct {
+	cats     commandCategory
+	keys     []keySpec
+	known    bool // the command, and so its categories, are known
+	complete bool // the keys can all be found using the key specs
+}
+
+// classify classifies the command using the table, or if it isn't listed
+// there, using the server's COMMAND INFO.
+func (w *impl) classify(cmd string, args []interface{}) classification {
+	if info, ok := listedCommand(cmd); ok {
+		return classification{
+			cats:     categoriesOf(cmd, args),
+			keys:     info.keys,
+			known:    true,
+			complete: true,
+		}
+	}
+	server, err := w.server.command(w, cmd, args)
+	if err != nil || server == nil {
+		return classification{}
+	}
+	return classification{
+		cats:     server.cats,
+		keys:     server.keys,
+		known:    true,
+		complete: server.complete,
+	}
+}
+
+// keyIndexes returns the indexes of the classified command's keys
+func (c classification) keyIndexes(args []interface{}) []int {
+	return findKeys(c.keys, len(args), func(i int) string {
+		return argString(args[i])
+	})
+}
+
+// serverCommand is a command as described by Redis' COMMAND INFO
+type serverCommand struct {
+	cats     commandCategory
+	keys     []keySpec
+	complete bool // the keys can all be found using the key specs
+}
+
+// commandInfoRetry is how long a failed COMMAND INFO is cached for, before
+// it's asked again
+const commandInfoRetry = time.Minute
+
+// serverCommands caches the commands described by Redis' COMMAND INFO, by
+// their lower case name, including subcommands ("config|set"). A command Redis
+// doesn't know of is cached as nil, and one which COMMAND INFO failed for is
+// cached with its error until commandInfoRetry has elapsed.
+type serverCommands struct {
+	mu     sync.RWMutex
+	known  map[string]*serverCommand
+	failed map[string]failedCommand
+}
+
+// failedCommand is a failed COMMAND INFO, and when it failed
+type failedCommand struct {
+	err error
+	at  time.Time
+}
+
+func newServerCommands() *serverCommands {
+	return &serverCommands{
+		known:  make(map[string]*serverCommand),
+		failed: make(map[string]failedCommand),
+	}
+}
+
+// command returns the command, or its subcommand, getting it using COMMAND
+// INFO if it's not cached. A command Redis doesn't know of is nil.
+func (s *serverCommands) command(w *impl, cmd string, args []interface{}) (*serverCommand, error) {
+	name := strings.ToLower(cmd)
+	sub := ""
+	if len(args) > 0 {
+		sub = name + "|" + strings.ToLower(argString(args[0]))
+	}
+
+	s.mu.RLock()
+	command, ok := s.known[name]
+	subCommand, subOk := s.known[sub]
+	failed, failedOk := s.failed[name]
+	s.mu.RUnlock()
+	if ok {
+		if subOk {
+			return subCommand, nil
+		}
+		return command, nil
+	}
+	if failedOk && time.Since(failed.at) < commandInfoRetry {
+		return nil, failed.err
+	}
+
+	// COMMAND INFO is sent on a connection of its own, as one from Conn may
+	// have pending replies
+	conn := w.pool.Get()
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("COMMAND", "INFO", name))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed[name] = failedCommand{err: err, at: time.Now()}
+		return nil, err
+	}
+	delete(s.failed, name)
+	// some servers reply with every command, rather than those asked for
+	for _, info := range reply {
+		if info != nil {
+			s.parse(info)
+		}
+	}
+	if _, ok := s.known[name]; !ok {
+		s.known[name] = nil
+	}
+	if subCommand, ok := s.known[sub]; ok && sub != "" {
+		return subCommand, nil
+	}
+	return s.known[name], nil
+}
+
+// parse caches the command of a COMMAND INFO reply, and its subcommands; the
+// lock must be held
+func (s *serverCommands) parse(reply interface{}) {
+	info, err := redis.Values(reply, nil)
+	if err != nil || len(info) < 3 {
+		return
+	}
+	name, err := redis.String(info[0], nil)
+	if err != nil {
+		return
+	}
+
+	command := &serverCommand{complete: true}
+	flags, _ := redis.Strings(info[2], nil)
+	for _, flag := range flags {
+		switch flag {
+		case "write":
+			command.cats |= catWrite
+		case "readonly":
+			command.cats |= catRead
+		case "admin":
+			command.cats |= catAdmin
+		case "pubsub":
+			command.cats |= catPubSub
+		case "movablekeys":
+			// the first, last & step of the keys don't find them all
+			command.complete = false
+		}
+	}
+	// Redis 6 adds the ACL categories
+	if len(info) > 6 {
+		cats, _ := redis.Strings(info[6], nil)
+		for _, cat := range cats {
+			command.cats |= categories[strings.ToLower(cat)]
+		}
+	}
+
+	// Redis 7 adds the key specs, which replace the first, last & step
+	if len(info) > 8 {
+		command.keys, command.complete = parseKeySpecs(info[8])
+	} else if len(info) > 5 {
+		first, _ := redis.Int(info[3], nil)
+		last, _ := redis.Int(info[4], nil)
+		step, _ := redis.Int(info[5], nil)
+		if first > 0 {
+			command.keys = []keySpec{legacyKeySpec(first, last, step)}
+		}
+	}
+	s.known[strings.ToLower(name)] = command
+
+	// Redis 7 lists the subcommands, in the same form, after the key specs
+	if len(info) > 9 {
+		subs, _ := redis.Values(info[9], nil)
+		for _, sub := range subs {
+			s.parse(sub)
+		}
+	}
+}
+
+// legacyKeySpec converts the first, last & step of the keys, which count the
+// command's name, into a keySpec
+func legacyKeySpec(first, last, step int) keySpec {
+	if last > 0 {
+		last--
+	}
+	if step < 1 {
+		step = 1
+	}
+	return keySpec{first: first - 1, last: last, step: step}
+}
+
+// parseKeySpecs converts Redis 7 key specs into keySpecs, returning false if
+// they don't find every key: as they're incomplete, or of a form which
+// keySpec can't express.
+//
+// See: https://redis.io/docs/reference/key-specs/
+func parseKeySpecs(reply interface{}) ([]keySpec, bool) {
+	specs, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, false
+	}
+	keys := make([]keySpec, 0, len(specs))
+	for _, spec := range specs {
+		key, ok := parseKeySpec(spec)
+		if !ok {
+			return keys, false
+		}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+// parseKeySpec converts a single Redis 7 key spec into a keySpec
+func parseKeySpec(reply interface{}) (keySpec, bool) {
+	spec, err := replyMap(reply, nil)
+	if err != nil {
+		return keySpec{}, false
+	}
+	flags, _ := redis.Strings(spec["flags"], nil)
+	for _, flag := range flags {
+		if strings.EqualFold(flag, "incomplete") {
+			return keySpec{}, false
+		}
+	}
+	begin, err1 := replyMap(spec["begin_search"], nil)
+	find, err2 := replyMap(spec["find_keys"], nil)
+	if err1 != nil || err2 != nil {
+		return keySpec{}, false
+	}
+	beginSpec, _ := replyMap(begin["spec"], nil)
+	findSpec, _ := replyMap(find["spec"], nil)
+
+	// the indexes count the command's name, which args don't
+	var key keySpec
+	switch mapString(begin, "type") {
+	case "index":
+		key.first = int(mapInt64(beginSpec, "index")) - 1
+	case "keyword":
+		key.keyword = mapString(beginSpec, "keyword")
+		if key.from = int(mapInt64(beginSpec, "startfrom")); key.from > 0 {
+			key.from--
+		}
+	default:
+		return keySpec{}, false
+	}
+
+	switch mapString(find, "type") {
+	case "range":
+		last := int(mapInt64(findSpec, "lastkey"))
+		key.step = int(mapInt64(findSpec, "keystep"))
+		if limit := mapInt64(findSpec, "limit"); limit > 1 {
+			// the keys are the first 1/limit of the rest, as with XREAD
+			if key.keyword != "STREAMS" || last != -1 || limit != 2 {
+				return keySpec{}, false
+			}
+			return keySpec{streams: true}, true
+		}
+		if last >= 0 && key.keyword == "" {
+			last += key.first
+		}
+		key.last = last
+	case "keynum":
+		// the number of keys, followed by the keys
+		keyNum := int(mapInt64(findSpec, "keynumidx"))
+		if key.keyword != "" || mapInt64(findSpec, "firstkey") != int64(keyNum+1) || mapInt64(findSpec, "keystep") != 1 {
+			return keySpec{}, false
+		}
+		return keySpec{first: key.first + keyNum, numkeys: true}, true
+	default:
+		return keySpec{}, false
+	}
+	if key.step < 1 {
+		key.step = 1
+	}
+	return key, true
+}
@@ -0,0 +1,157 @@
+package wredis_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadOnly", func() {
+	testKey := "wredis::test::readonly"
+
+	Context("Redis", func() {
+		var w Wredis
+
+		BeforeEach(func() {
+			Ω(safe.Set(testKey, "value")).Should(Succeed())
+
+			var err error
+			w, err = Unsafe(ReadOnly(true))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(w.Close()).Should(Succeed())
+			Ω(unsafe.FlushAll()).Should(Succeed())
+		})
+
+		It("should read", func() {
+			Ω(w.Get(testKey)).Should(Equal("value"))
+			Ω(w.Exists(testKey)).Should(BeTrue())
+			Ω(w.Do("GET", testKey)).Should(BeEquivalentTo("value"))
+		})
+
+		It("should not write", func() {
+			Ω(w.Set(testKey, "other")).Should(Equal(ErrReadOnly))
+			_, err := w.Del(testKey)
+			Ω(err).Should(Equal(ErrReadOnly))
+			_, err = w.Incr(testKey)
+			Ω(err).Should(Equal(ErrReadOnly))
+			_, err = w.LPush(testKey, "value")
+			Ω(err).Should(Equal(ErrReadOnly))
+			_, err = w.SAdd(testKey, "value")
+			Ω(err).Should(Equal(ErrReadOnly))
+			Ω(w.Rename(testKey, "wredis::test::other")).Should(Equal(ErrReadOnly))
+			_, err = w.Expire(testKey, 1)
+			Ω(err).Should(Equal(ErrReadOnly))
+			_, err = w.Do("set", testKey, "other")
+			Ω(err).Should(Equal(ErrReadOnly))
+			Ω(w.FlushAll()).Should(Equal(ErrReadOnly))
+			_, err = w.DelPattern("wredis::test::*")
+			Ω(err).Should(Equal(ErrReadOnly))
+
+			Ω(w.Get(testKey)).Should(Equal("value"))
+		})
+
+		It("should be inherited by Select", func() {
+			db, err := w.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(db.Set(testKey, "value")).Should(Equal(ErrReadOnly))
+		})
+	})
+
+	Context("COMMAND INFO", func() {
+		var (
+			server *fakeServer
+			w      Wredis
+		)
+
+		// info returns a COMMAND INFO entry
+		info := func(name string, flags ...string) string {
+			reply := fmt.Sprintf("$%d\r\n%s\r\n:-1\r\n*%d\r\n", len(name), name, len(flags))
+			for _, flag := range flags {
+				reply += "+" + flag + "\r\n"
+			}
+			return reply
+		}
+
+		sent := func(cmd string) int {
+			n := 0
+			for _, args := range server.Commands() {
+				if strings.EqualFold(args[0], cmd) {
+					n++
+				}
+			}
+			return n
+		}
+
+		BeforeEach(func() {
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("COMMAND", func(args []string) string {
+				switch strings.ToLower(args[2]) {
+				case "mod.write":
+					return "*1\r\n*3\r\n" + info("mod.write", "write", "denyoom")
+				case "mod.read":
+					return "*1\r\n*3\r\n" + info("mod.read", "readonly", "fast")
+				case "function":
+					return "*1\r\n*10\r\n" + info("function") +
+						strings.Repeat(":0\r\n", 6) + "*2\r\n" +
+						"*3\r\n" + info("function|load", "write", "noscript") +
+						"*3\r\n" + info("function|list", "noscript")
+				}
+				return "*1\r\n_\r\n"
+			})
+
+			w, err = Safe(Host("127.0.0.1"), Port(server.Port()), ReadOnly(true))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Ω(w.Close()).Should(Succeed())
+			server.Close()
+		})
+
+		It("should classify unknown commands using COMMAND INFO", func() {
+			_, err := w.Do("MOD.WRITE", "key")
+			Ω(err).Should(Equal(ErrReadOnly))
+			Ω(sent("MOD.WRITE")).Should(Equal(0))
+
+			_, err = w.Do("MOD.READ", "key")
+			Ω(err).Should(HaveOccurred())
+			Ω(errors.Is(err, ErrReadOnly)).Should(BeFalse())
+			Ω(sent("MOD.READ")).Should(Equal(1))
+
+			// the flags are cached
+			_, err = w.Do("MOD.WRITE", "key")
+			Ω(err).Should(Equal(ErrReadOnly))
+			Ω(sent("COMMAND")).Should(Equal(2))
+		})
+
+		It("should classify subcommands", func() {
+			_, err := w.Do("FUNCTION", "LOAD", "#!lua name=lib\n")
+			Ω(err).Should(Equal(ErrReadOnly))
+
+			_, err = w.Do("FUNCTION", "LIST")
+			Ω(errors.Is(err, ErrReadOnly)).Should(BeFalse())
+			Ω(sent("FUNCTION")).Should(Equal(1))
+			Ω(sent("COMMAND")).Should(Equal(1))
+		})
+
+		It("should treat commands which can't be classified as writes", func() {
+			server.Handle("COMMAND", func([]string) string {
+				return "-ERR unknown command 'COMMAND'\r\n"
+			})
+
+			_, err := w.Do("MOD.READ", "key")
+			Ω(err).Should(Equal(ErrReadOnly))
+			Ω(sent("MOD.READ")).Should(Equal(0))
+		})
+	})
+})
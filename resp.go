@@ -0,0 +1,719 @@
+package wredis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Map is a RESP3 map reply, keyed by the string form of the map keys.
+//
+// See: https://github.com/redis/redis-specifications/blob/master/protocol/RESP3.md
+type Map map[string]interface{}
+
+// Attributed is a reply which the server sent along with RESP3 attributes.
+type Attributed struct {
+	Attributes Map
+	Reply      interface{}
+}
+
+// StringMap is a helper that converts a map reply into a map[string]string. It
+// accepts both RESP3 maps, and the flat key/value arrays RESP2 returns for the
+// same commands (e.g. HGETALL).
+func StringMap(reply interface{}, err error) (map[string]string, error) {
+	m, ok := reply.(Map)
+	if err != nil || !ok {
+		return redis.StringMap(reply, err)
+	}
+	sm := make(map[string]string, len(m))
+	for k, v := range m {
+		s, err := stringValue(v)
+		if err != nil {
+			return nil, err
+		}
+		sm[k] = s
+	}
+	return sm, nil
+}
+
+// stringValue converts a single reply value into a string, including numbers
+func stringValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return redis.String(v, nil)
+}
+
+// Float64 is a helper that converts a reply into a float64. It accepts both
+// RESP3 doubles and the bulk strings RESP2 returns for the same commands (e.g.
+// ZSCORE).
+func Float64(reply interface{}, err error) (float64, error) {
+	if f, ok := reply.(float64); ok && err == nil {
+		return f, nil
+	}
+	return redis.Float64(reply, err)
+}
+
+// protocolError is returned when the server sends an unparseable reply; the
+// connection can't be used after one.
+type protocolError string
+
+func (pe protocolError) Error() string {
+	return fmt.Sprintf("wredis: %s (possible server error or unsupported concurrent read by application)", string(pe))
+}
+
+// respReader reads RESP2 & RESP3 replies.
+type respReader struct {
+	br *bufio.Reader
+}
+
+// readReply reads the next reply, and if it was sent as a RESP3 push message.
+func (r respReader) readReply() (interface{}, bool, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(line) == 0 {
+		return nil, false, protocolError("short response line")
+	}
+
+	if line[0] == '>' {
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, false, protocolError("bad push length")
+		}
+		push, err := r.readArray(n)
+		return push, true, err
+	}
+
+	reply, err := r.parse(line)
+	return reply, false, err
+}
+
+// read reads the next value, pushes cannot be nested so are an error.
+func (r respReader) read() (interface{}, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, protocolError("short response line")
+	}
+	return r.parse(line)
+}
+
+// parse the value whose first line has already been read
+func (r respReader) parse(line []byte) (interface{}, error) {
+	switch line[0] {
+	case '+':
+		switch string(line[1:]) {
+		case "OK":
+			// avoid allocation for frequent "+OK" response
+			return okReply, nil
+		case "PONG":
+			// avoid allocation in PING command benchmarks :)
+			return pongReply, nil
+		}
+		return string(line[1:]), nil
+	case '-':
+		return redis.Error(string(line[1:])), nil
+	case ':':
+		return parseInt(line[1:])
+	case '$', '=', '!':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		p, err := r.readBlob(n)
+		if err != nil {
+			return nil, err
+		}
+		switch line[0] {
+		case '!':
+			return redis.Error(string(p)), nil
+		case '=':
+			// verbatim strings are prefixed with their format, e.g. "txt:"
+			if len(p) < 4 || p[3] != ':' {
+				return nil, protocolError("bad verbatim string")
+			}
+			return p[4:], nil
+		}
+		return p, nil
+	case '*', '~':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		return r.readArray(n)
+	case '%':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		return r.readMap(n)
+	case '|':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, protocolError("bad attribute length")
+		}
+		attrs, err := r.readMap(n)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		return Attributed{Attributes: attrs, Reply: reply}, nil
+	case '_':
+		return nil, nil
+	case '#':
+		switch string(line[1:]) {
+		case "t":
+			return true, nil
+		case "f":
+			return false, nil
+		}
+		return nil, protocolError("bad boolean")
+	case ',':
+		return parseDouble(line[1:])
+	case '(':
+		n, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
+			return nil, protocolError("bad big number")
+		}
+		return n, nil
+	}
+	return nil, protocolError("unexpected response line")
+}
+
+// readArray reads n values
+func (r respReader) readArray(n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	for i := range values {
+		v, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// readMap reads n key/value pairs
+func (r respReader) readMap(n int) (Map, error) {
+	m := make(Map, n)
+	for i := 0; i < n; i++ {
+		k, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		m[mapKey(k)] = v
+	}
+	return m, nil
+}
+
+// readBlob reads a blob of n bytes, followed by a CRLF
+func (r respReader) readBlob(n int) ([]byte, error) {
+	p := make([]byte, n+2)
+	if _, err := io.ReadFull(r.br, p); err != nil {
+		return nil, err
+	}
+	if p[n] != '\r' || p[n+1] != '\n' {
+		return nil, protocolError("bad bulk string format")
+	}
+	return p[:n], nil
+}
+
+// readBulkInto reads a bulk string reply, appending it to dst[:0] rather than
+// allocating a new slice. A nil reply returns redis.ErrNil, and an error reply
+// is returned as replyErr; the connection is still usable after either.
+func (r respReader) readBulkInto(dst []byte) (p []byte, replyErr, err error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil, protocolError("short response line")
+	}
+
+	switch line[0] {
+	case '$', '=':
+		n, err := parseLen(line[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if n < 0 {
+			return nil, redis.ErrNil, nil
+		}
+		if p, err = r.readBlobInto(dst, n); err != nil {
+			return nil, nil, err
+		}
+		if line[0] == '=' {
+			if len(p) < 4 || p[3] != ':' {
+				return nil, nil, protocolError("bad verbatim string")
+			}
+			p = append(p[:0], p[4:]...)
+		}
+		return p, nil, nil
+	case '_':
+		return nil, redis.ErrNil, nil
+	}
+
+	// anything else is parsed as usual, and converted
+	reply, err := r.parse(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a, ok := reply.(Attributed); ok {
+		reply = a.Reply
+	}
+	switch reply := reply.(type) {
+	case []byte:
+		return append(dst[:0], reply...), nil, nil
+	case redis.Error:
+		return nil, reply, nil
+	case string:
+		return append(dst[:0], reply...), nil, nil
+	case int64:
+		return strconv.AppendInt(dst[:0], reply, 10), nil, nil
+	}
+	return nil, fmt.Errorf("wredis: unexpected type %T for bulk string", reply), nil
+}
+
+// readStringsInto reads an array reply of bulk strings, appending them to
+// dst[:0]. Nil elements are returned as empty strings, as with redis.Strings.
+// A nil reply returns redis.ErrNil, and an error reply is returned as replyErr.
+func (r respReader) readStringsInto(dst []string) (ss []string, replyErr, err error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil, protocolError("short response line")
+	}
+
+	switch line[0] {
+	case '*', '~':
+	case '_':
+		return nil, redis.ErrNil, nil
+	default:
+		reply, err := r.parse(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		if a, ok := reply.(Attributed); ok {
+			reply = a.Reply
+		}
+		switch reply := reply.(type) {
+		case redis.Error:
+			return nil, reply, nil
+		case []interface{}:
+			ss = dst[:0]
+			for _, v := range reply {
+				if v == nil {
+					ss = append(ss, "")
+					continue
+				}
+				s, err := stringValue(v)
+				if err != nil && replyErr == nil {
+					replyErr = err
+				}
+				ss = append(ss, s)
+			}
+			return ss, replyErr, nil
+		}
+		return nil, fmt.Errorf("wredis: unexpected type %T for strings", reply), nil
+	}
+
+	n, err := parseLen(line[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if n < 0 {
+		return nil, redis.ErrNil, nil
+	}
+
+	ss = dst[:0]
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(line) == 0 {
+			return nil, nil, protocolError("short response line")
+		}
+		if line[0] != '$' {
+			// not a bulk string, e.g. an integer; parse & convert it
+			v, err := r.parse(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			if v == nil {
+				ss = append(ss, "")
+				continue
+			}
+			s, err := stringValue(v)
+			if err != nil && replyErr == nil {
+				replyErr = err
+			}
+			ss = append(ss, s)
+			continue
+		}
+		size, err := parseLen(line[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if size < 0 {
+			ss = append(ss, "")
+			continue
+		}
+		s, err := r.readString(size)
+		if err != nil {
+			return nil, nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, replyErr, nil
+}
+
+// readBlobInto reads a blob of n bytes followed by a CRLF, appending the blob
+// to dst[:0]
+func (r respReader) readBlobInto(dst []byte, n int) ([]byte, error) {
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	p := dst[:n]
+	if _, err := io.ReadFull(r.br, p); err != nil {
+		return nil, err
+	}
+	if err := r.readCRLF(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// readString reads a blob of n bytes followed by a CRLF, as a string. Short
+// strings are read straight from the buffer, so only the string is allocated.
+func (r respReader) readString(n int) (string, error) {
+	if n+2 > r.br.Size() {
+		p, err := r.readBlob(n)
+		return string(p), err
+	}
+	p, err := r.br.Peek(n + 2)
+	if err != nil {
+		return "", err
+	}
+	if p[n] != '\r' || p[n+1] != '\n' {
+		return "", protocolError("bad bulk string format")
+	}
+	s := string(p[:n])
+	r.br.Discard(n + 2)
+	return s, nil
+}
+
+// readCRLF reads the CRLF terminating a blob
+func (r respReader) readCRLF() error {
+	cr, err := r.br.ReadByte()
+	if err != nil {
+		return err
+	}
+	lf, err := r.br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if cr != '\r' || lf != '\n' {
+		return protocolError("bad bulk string format")
+	}
+	return nil
+}
+
+// readLine reads a line, without the trailing CRLF
+func (r respReader) readLine() ([]byte, error) {
+	p, err := r.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError("long response line")
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := len(p) - 2
+	if i < 0 || p[i] != '\r' {
+		return nil, protocolError("bad response line terminator")
+	}
+	return p[:i], nil
+}
+
+var (
+	okReply   interface{} = "OK"
+	pongReply interface{} = "PONG"
+)
+
+// mapKey converts a map key into its string form
+func mapKey(k interface{}) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	}
+	return fmt.Sprint(k)
+}
+
+// parseLen parses a length, where -1 is a nil value
+func parseLen(p []byte) (int, error) {
+	if len(p) == 0 {
+		return -1, protocolError("malformed length")
+	}
+	if p[0] == '?' {
+		return -1, protocolError("streamed replies are not supported")
+	}
+	if p[0] == '-' && len(p) == 2 && p[1] == '1' {
+		return -1, nil
+	}
+	n, err := parseInt(p)
+	if err != nil || n < 0 {
+		return -1, protocolError("malformed length")
+	}
+	return int(n), nil
+}
+
+// parseInt parses an integer reply, without converting it to a string first
+func parseInt(p []byte) (int64, error) {
+	if len(p) == 0 {
+		return 0, protocolError("malformed integer")
+	}
+
+	var negate bool
+	if p[0] == '-' {
+		negate = true
+		p = p[1:]
+		if len(p) == 0 {
+			return 0, protocolError("malformed integer")
+		}
+	}
+
+	var n int64
+	for _, b := range p {
+		if b < '0' || b > '9' || n > (math.MaxInt64-9)/10 {
+			return 0, protocolError("malformed integer")
+		}
+		n = n*10 + int64(b-'0')
+	}
+	if negate {
+		n = -n
+	}
+	return n, nil
+}
+
+// parseDouble parses a RESP3 double
+func parseDouble(p []byte) (float64, error) {
+	switch string(p) {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	f, err := strconv.ParseFloat(string(p), 64)
+	if err != nil {
+		return 0, protocolError("malformed double")
+	}
+	return f, nil
+}
+
+// respWriter writes commands as RESP arrays of bulk strings. Numbers are
+// appended to fixed buffers, rather than formatted into new strings, so
+// writing a command doesn't allocate.
+type respWriter struct {
+	bw     *bufio.Writer
+	lenBuf [20]byte
+	numBuf [32]byte
+}
+
+// writeCommand writes the command and its arguments. Any write errors are
+// returned when the underlying writer is flushed.
+func (w *respWriter) writeCommand(cmd string, args []interface{}) {
+	w.writeLen('*', 1+len(args))
+	w.writeString(cmd)
+	for _, arg := range args {
+		w.writeArg(arg)
+	}
+}
+
+// writeStrings writes the command and its string arguments
+func (w *respWriter) writeStrings(cmd string, args []string) {
+	w.writeLen('*', 1+len(args))
+	w.writeString(cmd)
+	for _, arg := range args {
+		w.writeString(arg)
+	}
+}
+
+// writeArg writes a single argument, using the same conversions as redigo
+func (w *respWriter) writeArg(arg interface{}) {
+	switch arg := arg.(type) {
+	case string:
+		w.writeString(arg)
+	case []byte:
+		w.writeBytes(arg)
+	case int:
+		w.writeBytes(strconv.AppendInt(w.numBuf[:0], int64(arg), 10))
+	case int64:
+		w.writeBytes(strconv.AppendInt(w.numBuf[:0], arg, 10))
+	case uint:
+		w.writeBytes(strconv.AppendUint(w.numBuf[:0], uint64(arg), 10))
+	case uint64:
+		w.writeBytes(strconv.AppendUint(w.numBuf[:0], arg, 10))
+	case float64:
+		w.writeBytes(strconv.AppendFloat(w.numBuf[:0], arg, 'g', -1, 64))
+	case bool:
+		if arg {
+			w.writeString("1")
+		} else {
+			w.writeString("0")
+		}
+	case nil:
+		w.writeString("")
+	case redis.Argument:
+		w.writeArg(arg.RedisArg())
+	default:
+		w.writeString(fmt.Sprint(arg))
+	}
+}
+
+func (w *respWriter) writeLen(prefix byte, n int) {
+	w.bw.WriteByte(prefix)
+	w.bw.Write(strconv.AppendInt(w.lenBuf[:0], int64(n), 10))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) writeString(s string) {
+	w.writeLen('$', len(s))
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) writeBytes(p []byte) {
+	w.writeLen('$', len(p))
+	w.bw.Write(p)
+	w.bw.WriteString("\r\n")
+}
+
+// callKind is the type of reply a respCall expects
+type callKind int
+
+const (
+	callBulk    callKind = iota // a bulk string, read into bulk
+	callStrings                 // an array of strings, read into strs
+)
+
+// maxCallBuffer is the largest buffer (in bytes), and maxCallStrings the most
+// strings, kept by a pooled respCall; larger replies are let go, so one big
+// reply doesn't pin its memory in the pool.
+const (
+	maxCallBuffer  = 64 * 1024
+	maxCallStrings = 1024
+)
+
+// respCall is a command with string arguments whose reply is read straight
+// into reusable buffers, rather than decoded into a new interface{} & then
+// converted. It's sent with doCall.
+type respCall struct {
+	kind callKind
+	args []string
+	bulk []byte
+	strs []string
+	self []interface{} // holds the call, so Do(cmd, self...) doesn't allocate
+}
+
+var callPool = sync.Pool{
+	New: func() interface{} {
+		call := &respCall{}
+		call.self = []interface{}{call}
+		return call
+	},
+}
+
+// getCall returns a respCall from the pool, for the reply kind & arguments
+func getCall(kind callKind, args ...string) *respCall {
+	call := callPool.Get().(*respCall)
+	call.kind = kind
+	call.args = append(call.args[:0], args...)
+	return call
+}
+
+// putCall returns the call to the pool, unless its buffers have grown too big
+func putCall(call *respCall) {
+	if cap(call.bulk) > maxCallBuffer || cap(call.strs) > maxCallStrings {
+		return
+	}
+	for i := range call.args {
+		call.args[i] = ""
+	}
+	for i := range call.strs {
+		call.strs[i] = ""
+	}
+	call.bulk = call.bulk[:0]
+	call.strs = call.strs[:0]
+	callPool.Put(call)
+}
+
+// caller is implemented by the connections which can send a respCall, reading
+// its reply into the call's buffers.
+type caller interface {
+	call(cmd string, call *respCall) error
+}
+
+// doCall sends the call over the connection. The connections redigo's pool
+// returns aren't callers, and hide the *respConn they wrap; so the call is
+// passed through their Do as its only argument, which respConn.Do recognises.
+func doCall(conn redis.Conn, cmd string, call *respCall) error {
+	if c, ok := conn.(caller); ok {
+		return c.call(cmd, call)
+	}
+	_, err := conn.Do(cmd, call.self...)
+	return err
+}
+
+// asCall returns the respCall if it's the only argument, or nil. It's only
+// used by respConn, for calls passed through a pooled connection's Do.
+func asCall(args []interface{}) *respCall {
+	if len(args) != 1 {
+		return nil
+	}
+	call, _ := args[0].(*respCall)
+	return call
+}
+
+// read reads the call's reply, returning any error reply as replyErr
+func (call *respCall) read(r respReader) (replyErr, err error) {
+	// the buffers are only replaced on success, so they can be reused on retry
+	switch call.kind {
+	case callStrings:
+		var ss []string
+		if ss, replyErr, err = r.readStringsInto(call.strs); err == nil && replyErr == nil {
+			call.strs = ss
+		}
+	default:
+		var p []byte
+		if p, replyErr, err = r.readBulkInto(call.bulk); err == nil && replyErr == nil {
+			call.bulk = p
+		}
+	}
+	return replyErr, err
+}
@@ -0,0 +1,264 @@
+package wredis
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RetryPolicy configures how commands which fail with a transient error are
+// retried. Only idempotent commands (reads, and writes like SET & DEL) are
+// retried, unless they are explicitly allowed; a connection that could not be
+// dialed is always retried since nothing was sent.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles for each one
+	// after it
+	Backoff time.Duration
+	// Jitter is the maximum random duration added to each delay
+	Jitter time.Duration
+	// RetryOn returns true if the error should be retried; if nil, dial
+	// errors, broken connections and the LOADING, TRYAGAIN, CLUSTERDOWN &
+	// MASTERDOWN error replies are retried.
+	RetryOn func(error) bool
+	// Allow are non-idempotent commands which should also be retried, e.g.
+	// INCR or LPUSH, if it's acceptable for them to be applied more than once
+	Allow []string
+	// OnRetry is called for each failed attempt, before it is retried
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a failed attempt which is about to be retried
+type RetryAttempt struct {
+	Command string        // the command sent, in upper case
+	Attempt int           // the number of the failed attempt, from 1
+	Err     error         // the error the attempt failed with
+	Backoff time.Duration // the delay before the next attempt
+}
+
+// Retry sets the RetryPolicy in the Config.
+func Retry(policy RetryPolicy) Option {
+	return func(cfg Config) (Config, error) {
+		if policy.MaxAttempts < 1 {
+			return cfg, errors.New("wredis: invalid retry attempts")
+		}
+		if policy.Backoff < 0 || policy.Jitter < 0 {
+			return cfg, errors.New("wredis: invalid retry backoff")
+		}
+		allow := make([]string, len(policy.Allow))
+		for i, cmd := range policy.Allow {
+			allow[i] = strings.ToUpper(cmd)
+		}
+		policy.Allow = allow
+		cfg.RetryPolicy = policy
+		return cfg, nil
+	}
+}
+
+// retries returns true if commands are retried
+func (p RetryPolicy) retries() bool {
+	return p.MaxAttempts > 1
+}
+
+// retryable returns true if the command may be sent more than once
+func (p RetryPolicy) retryable(cmd string) bool {
+	if lookupCommand(cmd).flags&cmdIdempotent != 0 {
+		return true
+	}
+	for _, allowed := range p.Allow {
+		if strings.EqualFold(cmd, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryOn returns true if the error should be retried
+func (p RetryPolicy) retryOn(err error) bool {
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	return transient(err)
+}
+
+// backoff returns the delay after the failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < time.Minute; i++ {
+		d *= 2
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return d
+}
+
+// transient returns true for errors which may succeed if retried
+func transient(err error) bool {
+	if err, ok := err.(redis.Error); ok {
+		for _, prefix := range []string{"LOADING", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN"} {
+			if strings.HasPrefix(string(err), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return connectionError(err)
+}
+
+// connectionError returns true for errors dialing, or using, a connection
+func connectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryConn is a redis.Conn which retries commands that fail with a transient
+// error. The underlying connection is only got once a command is sent, so a
+// failure to dial can be retried; and is replaced if it's broken. Once the
+// connection has state (e.g. after Send or MULTI) commands are not retried.
+type retryConn struct {
+	w      *impl
+	conn   redis.Conn
+	pinned bool
+}
+
+var _ redis.ConnWithTimeout = &retryConn{}
+
+// get returns the underlying connection, getting one if needed
+func (c *retryConn) get() redis.Conn {
+	if c.conn == nil {
+		c.conn = c.w.conn()
+	}
+	return c.conn
+}
+
+// Close implements redis.Conn
+func (c *retryConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Err implements redis.Conn
+func (c *retryConn) Err() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Err()
+}
+
+// Do implements redis.Conn
+func (c *retryConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, cmd, args...)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout
+func (c *retryConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" || c.pinned {
+		return doWithTimeout(c.get(), timeout, cmd, args...)
+	}
+	return c.retry(cmd, func(conn redis.Conn) (interface{}, error) {
+		return doWithTimeout(conn, timeout, cmd, args...)
+	})
+}
+
+// call implements caller
+func (c *retryConn) call(cmd string, call *respCall) error {
+	if c.pinned {
+		return doCall(c.get(), cmd, call)
+	}
+	_, err := c.retry(cmd, func(conn redis.Conn) (interface{}, error) {
+		return nil, doCall(conn, cmd, call)
+	})
+	return err
+}
+
+// retry sends the command with do, retrying it as the RetryPolicy allows
+func (c *retryConn) retry(cmd string, do func(redis.Conn) (interface{}, error)) (interface{}, error) {
+	policy := c.w.cfg.RetryPolicy
+	retryable := policy.retryable(cmd)
+	for attempt := 1; ; attempt++ {
+		conn := c.get()
+
+		// a connection which failed to dial is always retryable
+		sent := false
+		err := conn.Err()
+		var reply interface{}
+		if err == nil {
+			sent = true
+			reply, err = do(conn)
+		}
+
+		if err == nil || attempt >= policy.MaxAttempts || (sent && !retryable) || !policy.retryOn(err) {
+			if sent && lookupCommand(cmd).flags&cmdStateful != 0 {
+				c.pinned = true
+			}
+			return reply, err
+		}
+
+		backoff := policy.backoff(attempt)
+		atomic.AddInt64(&c.w.retries, 1)
+		if policy.OnRetry != nil {
+			policy.OnRetry(RetryAttempt{
+				Command: strings.ToUpper(cmd),
+				Attempt: attempt,
+				Err:     err,
+				Backoff: backoff,
+			})
+		}
+
+		// replace a broken connection
+		if conn.Err() != nil {
+			conn.Close()
+			c.conn = nil
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// doWithTimeout calls Do, or DoWithTimeout if there's a timeout, so that
+// commands without one can still be auto pipelined.
+func doWithTimeout(conn redis.Conn, timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if timeout == 0 {
+		return conn.Do(cmd, args...)
+	}
+	return redis.DoWithTimeout(conn, timeout, cmd, args...)
+}
+
+// Send implements redis.Conn. Commands are not retried after a Send.
+func (c *retryConn) Send(cmd string, args ...interface{}) error {
+	c.pinned = true
+	return c.get().Send(cmd, args...)
+}
+
+// Flush implements redis.Conn
+func (c *retryConn) Flush() error {
+	return c.get().Flush()
+}
+
+// Receive implements redis.Conn
+func (c *retryConn) Receive() (interface{}, error) {
+	return c.get().Receive()
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout
+func (c *retryConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.get(), timeout)
+}
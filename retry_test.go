@@ -0,0 +1,164 @@
+package wredis_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry", func() {
+	It("should fail given invalid attempts", func() {
+		_, err := Safe(Retry(RetryPolicy{}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid retry attempts"))
+	})
+
+	It("should fail given a negative backoff", func() {
+		_, err := Safe(Retry(RetryPolicy{MaxAttempts: 2, Backoff: -time.Second}))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid retry backoff"))
+	})
+
+	Context("fake server", func() {
+		var (
+			server   *fakeServer
+			w        Wredis
+			mu       sync.Mutex
+			attempts []RetryAttempt
+			failures int
+		)
+
+		// loading replies LOADING to the first failures commands
+		loading := func(reply string) fakeHandler {
+			return func([]string) string {
+				mu.Lock()
+				defer mu.Unlock()
+				if failures > 0 {
+					failures--
+					return "-LOADING Redis is loading the dataset in memory\r\n"
+				}
+				return reply
+			}
+		}
+
+		newWredis := func(policy RetryPolicy, opts ...Option) {
+			policy.OnRetry = func(attempt RetryAttempt) {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts = append(attempts, attempt)
+			}
+			var err error
+			w, err = Safe(append([]Option{
+				Host("127.0.0.1"),
+				Port(server.Port()),
+				Retry(policy),
+			}, opts...)...)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			attempts = nil
+			failures = 2
+
+			var err error
+			server, err = newFakeServer(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			server.Handle("GET", loading("$5\r\nvalue\r\n"))
+			server.Handle("INCR", loading(":1\r\n"))
+		})
+
+		AfterEach(func() {
+			if w != nil {
+				Ω(w.Close()).Should(Succeed())
+			}
+			Ω(server.Close()).Should(Succeed())
+		})
+
+		It("should retry idempotent commands", func() {
+			newWredis(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+			Ω(w.Get("key")).Should(Equal("value"))
+			Ω(attempts).Should(HaveLen(2))
+			Ω(attempts[0].Command).Should(Equal("GET"))
+			Ω(attempts[0].Attempt).Should(Equal(1))
+			Ω(attempts[0].Err.Error()).Should(HavePrefix("LOADING"))
+			Ω(attempts[1].Attempt).Should(Equal(2))
+			Ω(attempts[1].Backoff).Should(Equal(2 * time.Millisecond))
+		})
+
+		It("should give up after MaxAttempts", func() {
+			newWredis(RetryPolicy{MaxAttempts: 2})
+
+			_, err := w.Get("key")
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(HavePrefix("LOADING"))
+			Ω(attempts).Should(HaveLen(1))
+		})
+
+		It("should not retry non-idempotent commands", func() {
+			newWredis(RetryPolicy{MaxAttempts: 3})
+
+			_, err := w.Incr("key")
+			Ω(err).Should(HaveOccurred())
+			Ω(attempts).Should(BeEmpty())
+		})
+
+		It("should retry non-idempotent commands which are allowed", func() {
+			newWredis(RetryPolicy{MaxAttempts: 3, Allow: []string{"incr"}})
+
+			Ω(w.Incr("key")).Should(BeEquivalentTo(1))
+			Ω(attempts).Should(HaveLen(2))
+		})
+
+		It("should only retry the errors RetryOn allows", func() {
+			newWredis(RetryPolicy{
+				MaxAttempts: 3,
+				RetryOn:     func(error) bool { return false },
+			})
+
+			_, err := w.Get("key")
+			Ω(err).Should(HaveOccurred())
+			Ω(attempts).Should(BeEmpty())
+		})
+
+		It("should not retry commands after Send", func() {
+			newWredis(RetryPolicy{MaxAttempts: 3})
+
+			_, err := w.Int(func(conn redis.Conn) (int, error) {
+				Ω(conn.Send("PING")).Should(Succeed())
+				_, err := conn.Do("GET", "key")
+				return 0, err
+			})
+			Ω(err).Should(HaveOccurred())
+			Ω(attempts).Should(BeEmpty())
+		})
+
+		It("should retry connections which fail to dial", func() {
+			dials := 0
+			dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dials++
+				if dials == 1 {
+					return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("refused")}
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+			failures = 0
+			newWredis(RetryPolicy{MaxAttempts: 2}, NetDialer(dial))
+
+			// even a non-idempotent command, as it was never sent
+			Ω(w.Incr("key")).Should(BeEquivalentTo(1))
+			Ω(attempts).Should(HaveLen(1))
+			Ω(dials).Should(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,160 @@
+package wredis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Doer sends a command, returning its reply; it's implemented by both a Wredis
+// and a redis.Conn.
+type Doer interface {
+	Do(string, ...interface{}) (interface{}, error)
+}
+
+// Script is a Lua script, which is run using EVALSHA so its source is only
+// sent to Redis when it isn't already cached.
+//
+// See: https://redis.io/commands/evalsha
+type Script struct {
+	keyCount int
+	src      string
+	hash     string
+	cached   int32 // 1 once the Script has been loaded or run
+}
+
+// NewScript returns a Script of the Lua source, which takes keyCount keys. A
+// keyCount of -1 takes any number of keys.
+func NewScript(keyCount int, src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{keyCount: keyCount, src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Hash returns the SHA1 hash of the Script's source
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// args returns the arguments of EVAL or EVALSHA, given the script or its hash
+func (s *Script) args(script string, keys []string, args []interface{}) ([]interface{}, error) {
+	if s.keyCount >= 0 && len(keys) != s.keyCount {
+		return nil, errors.New("wredis: invalid key count")
+	}
+	if any(keys, empty) {
+		return nil, errors.New("wredis: empty keys")
+	}
+	return redis.Args{}.Add(script, len(keys)).AddFlat(keys).Add(args...), nil
+}
+
+// Run runs the Script with EVALSHA, falling back to EVAL (which caches the
+// script) if Redis replies with NOSCRIPT. When pipelining use Send instead,
+// and within a transaction, where the reply is only QUEUED, Load the Script
+// before MULTI and then use SendHash.
+func (s *Script) Run(d Doer, keys []string, args ...interface{}) (interface{}, error) {
+	evalArgs, err := s.args(s.hash, keys, args)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := d.Do("EVALSHA", evalArgs...)
+	if noScript(err) {
+		evalArgs[0] = s.src
+		reply, err = d.Do("EVAL", evalArgs...)
+	}
+	if err == nil {
+		atomic.StoreInt32(&s.cached, 1)
+	}
+	return reply, err
+}
+
+// Send sends the Script over the redis.Conn without reading the reply, when
+// pipelining. Once the Script has been loaded or run it's sent with EVALSHA,
+// and before then with EVAL (so its source isn't sent every time). Pass its
+// reply to Retry, as Redis may have since lost it.
+func (s *Script) Send(conn redis.Conn, keys []string, args ...interface{}) error {
+	if atomic.LoadInt32(&s.cached) == 1 {
+		return s.SendHash(conn, keys, args...)
+	}
+	evalArgs, err := s.args(s.src, keys, args)
+	if err != nil {
+		return err
+	}
+	return conn.Send("EVAL", evalArgs...)
+}
+
+// SendHash sends the Script with EVALSHA over the redis.Conn, without reading
+// the reply. If the Script isn't loaded its reply is a NOSCRIPT error; so
+// within a transaction, Load the Script over the redis.Conn before MULTI.
+func (s *Script) SendHash(conn redis.Conn, keys []string, args ...interface{}) error {
+	evalArgs, err := s.args(s.hash, keys, args)
+	if err != nil {
+		return err
+	}
+	return conn.Send("EVALSHA", evalArgs...)
+}
+
+// Retry returns the reply, from Receive, of the pipelined Script; unless it's
+// a NOSCRIPT error, in which case the Script is run again with EVAL. It must
+// be called once every reply of the pipeline has been read. The replies of a
+// transaction, from EXEC, are never retried, as the Script would then be run
+// outside of the transaction.
+func (s *Script) Retry(d Doer, reply interface{}, err error, keys []string, args ...interface{}) (interface{}, error) {
+	if !noScript(err) {
+		return reply, err
+	}
+	evalArgs, err := s.args(s.src, keys, args)
+	if err != nil {
+		return nil, err
+	}
+	if reply, err = d.Do("EVAL", evalArgs...); err == nil {
+		atomic.StoreInt32(&s.cached, 1)
+	}
+	return reply, err
+}
+
+// noScript returns true if the error is a NOSCRIPT error
+func noScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// Load loads the Script into Redis' script cache.
+//
+// See: https://redis.io/commands/script-load
+func (s *Script) Load(d Doer) error {
+	_, err := redis.String(d.Do("SCRIPT", "LOAD", s.src))
+	if err == nil {
+		atomic.StoreInt32(&s.cached, 1)
+	}
+	return err
+}
+
+// LoadScripts loads every ".lua" file of the file system (e.g. an embed.FS)
+// into Redis' script cache, returning the Scripts by their path without the
+// extension. The Scripts take any number of keys.
+func (w *impl) LoadScripts(fsys fs.FS) (map[string]*Script, error) {
+	scripts := map[string]*Script{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".lua" {
+			return err
+		}
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		script := NewScript(-1, string(src))
+		if err = script.Load(w); err != nil {
+			return err
+		}
+		scripts[strings.TrimSuffix(name, ".lua")] = script
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scripts, nil
+}
@@ -0,0 +1,143 @@
+package wredis_test
+
+import (
+	"testing/fstest"
+
+	. "github.com/crowdriff/wredis"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scripts", func() {
+	testKey := "wredis::test::script"
+	script := NewScript(1, "return redis.call('INCRBY', KEYS[1], ARGV[1])")
+
+	BeforeEach(func() {
+		unsafe.Del(testKey)
+		_, err := unsafe.Do("SCRIPT", "FLUSH")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	cached := func(s *Script) bool {
+		exists, err := redis.Ints(safe.Do("SCRIPT", "EXISTS", s.Hash()))
+		Ω(err).ShouldNot(HaveOccurred())
+		return exists[0] == 1
+	}
+
+	It("should fail given the wrong number of keys", func() {
+		_, err := script.Run(safe, nil, 1)
+		Ω(err).Should(MatchError("wredis: invalid key count"))
+		_, err = script.Run(safe, []string{""}, 1)
+		Ω(err).Should(MatchError("wredis: empty keys"))
+	})
+
+	It("should run the script, caching it if it isn't already", func() {
+		Ω(cached(script)).Should(BeFalse())
+		Ω(redis.Int(script.Run(safe, []string{testKey}, 2))).Should(Equal(2))
+		Ω(cached(script)).Should(BeTrue())
+		Ω(redis.Int(script.Run(safe, []string{testKey}, 3))).Should(Equal(5))
+	})
+
+	It("should run the script with auto pipelining", func() {
+		w, err := Safe(AutoPipeline(1, 0, 16))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+		Ω(redis.Int(script.Run(w, []string{testKey}, 2))).Should(Equal(2))
+		Ω(redis.Int(script.Run(w, []string{testKey}, 2))).Should(Equal(4))
+	})
+
+	It("should run the script over a redis.Conn", func() {
+		conn, err := redis.Dial("tcp", "127.0.0.1:6379")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		Ω(redis.Int(script.Run(conn, []string{testKey}, 2))).Should(Equal(2))
+	})
+
+	It("should send the script within a transaction", func() {
+		conn, err := redis.Dial("tcp", "127.0.0.1:6379")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		s := NewScript(1, "return redis.call('INCRBY', KEYS[1], ARGV[1])")
+		Ω(conn.Send("MULTI")).Should(Succeed())
+		Ω(s.Send(conn, []string{testKey}, 2)).Should(Succeed())
+		Ω(s.SendHash(conn, []string{testKey}, 3)).Should(Succeed())
+		replies, err := redis.Values(conn.Do("EXEC"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(replies).Should(Equal([]interface{}{int64(2), int64(5)}))
+	})
+
+	It("should run the script loaded before the transaction within it", func() {
+		conn, err := redis.Dial("tcp", "127.0.0.1:6379")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		Ω(script.Load(conn)).Should(Succeed())
+		Ω(conn.Send("MULTI")).Should(Succeed())
+		Ω(script.SendHash(conn, []string{testKey}, 2)).Should(Succeed())
+		Ω(conn.Send("INCR", testKey)).Should(Succeed())
+		replies, err := redis.Values(conn.Do("EXEC"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(replies).Should(Equal([]interface{}{int64(2), int64(3)}))
+	})
+
+	It("should not retry the script outside of the transaction", func() {
+		conn, err := redis.Dial("tcp", "127.0.0.1:6379")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		Ω(conn.Send("MULTI")).Should(Succeed())
+		Ω(script.SendHash(conn, []string{testKey}, 2)).Should(Succeed())
+		replies, err := redis.Values(conn.Do("EXEC"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		reply, err := script.Retry(conn, replies[0], nil, []string{testKey}, 2)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reply).Should(MatchError(HavePrefix("NOSCRIPT")))
+		Ω(safe.Exists(testKey)).Should(BeFalse())
+	})
+
+	It("should retry the pipelined script if Redis has lost it", func() {
+		conn, err := redis.Dial("tcp", "127.0.0.1:6379")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		// once run, the script is sent with EVALSHA
+		Ω(redis.Int(script.Run(conn, []string{testKey}, 1))).Should(Equal(1))
+		_, err = unsafe.Do("SCRIPT", "FLUSH")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(script.Send(conn, []string{testKey}, 2)).Should(Succeed())
+		Ω(script.Send(conn, []string{testKey}, 3)).Should(Succeed())
+		Ω(conn.Flush()).Should(Succeed())
+		first, firstErr := conn.Receive()
+		second, secondErr := conn.Receive()
+		Ω(firstErr).Should(MatchError(HavePrefix("NOSCRIPT")))
+
+		Ω(redis.Int(script.Retry(conn, first, firstErr, []string{testKey}, 2))).Should(Equal(3))
+		Ω(redis.Int(script.Retry(conn, second, secondErr, []string{testKey}, 3))).Should(Equal(6))
+	})
+
+	It("should load the scripts of a file system", func() {
+		scripts, err := safe.LoadScripts(fstest.MapFS{
+			"get.lua":          {Data: []byte("return redis.call('GET', KEYS[1])")},
+			"counter/incr.lua": {Data: []byte("return redis.call('INCR', KEYS[1])")},
+			"README.md":        {Data: []byte("not a script")},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scripts).Should(HaveLen(2))
+		Ω(scripts).Should(HaveKey("get"))
+		Ω(scripts).Should(HaveKey("counter/incr"))
+		Ω(cached(scripts["get"])).Should(BeTrue())
+
+		Ω(redis.Int(scripts["counter/incr"].Run(safe, []string{testKey}))).Should(Equal(1))
+		Ω(redis.String(scripts["get"].Run(safe, []string{testKey}))).Should(Equal("1"))
+	})
+
+	It("should fail to load a script which doesn't compile", func() {
+		_, err := safe.LoadScripts(fstest.MapFS{"bad.lua": {Data: []byte("return (")}})
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -1,6 +1,8 @@
 package wredis
 
 import (
+	"errors"
+
 	"github.com/garyburd/redigo/redis"
 )
 
@@ -18,7 +20,10 @@ func (w *impl) DBSize() (int64, error) {
 //
 // See: http://redis.io/commands/flushall
 func (w *impl) FlushAll() error {
-	if !w.unsafe {
+	if w.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if !w.cfg.Policy.allows("FLUSHALL", nil) {
 		return unsafeErr("FlushAll")
 	}
 	// all hands to battle stations!
@@ -31,7 +36,10 @@ func (w *impl) FlushAll() error {
 //
 // See: http://redis.io/commands/flushdb
 func (w *impl) FlushDB() error {
-	if !w.unsafe {
+	if w.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if !w.cfg.Policy.allows("FLUSHDB", nil) {
 		return unsafeErr("FlushDB")
 	}
 	// all stop, red alert!
@@ -39,3 +47,28 @@ func (w *impl) FlushDB() error {
 		return redis.String(conn.Do("FlUSHDB"))
 	})
 }
+
+// SwapDB swaps the data of two databases, so that clients connected to one
+// immediately see the data of the other. A Wredis returned by Select for either
+// DB will fail with ErrDBSwapped, until Select is called again.
+//
+// See: https://redis.io/commands/swapdb
+func (w *impl) SwapDB(a, b uint) error {
+	if w.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if !w.cfg.Policy.allows("SWAPDB", nil) {
+		return unsafeErr("SwapDB")
+	}
+	if w.cfg.Cluster {
+		return errors.New("wredis: no swapdb")
+	}
+	err := w.ok("SwapDB", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("SWAPDB", a, b))
+	})
+	if err != nil {
+		return err
+	}
+	w.swaps.swap(a, b)
+	return nil
+}
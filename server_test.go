@@ -1,6 +1,10 @@
 package wredis_test
 
 import (
+	"errors"
+
+	. "github.com/crowdriff/wredis"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -29,4 +33,51 @@ var _ = Describe("Server", func() {
 			Ω(unsafe.FlushDB()).Should(Succeed())
 		})
 	})
+
+	Context("SwapDB", func() {
+		testKey := "wredis::test::swapdb"
+
+		AfterEach(func() {
+			Ω(unsafe.FlushAll()).Should(Succeed())
+		})
+
+		It("should not be able to SwapDB with a safe impl", func() {
+			err := safe.SwapDB(0, 1)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: SwapDB requires unsafe impl. See wredis.Unsafe"))
+		})
+
+		It("should swap the DBs with an unsafe impl", func() {
+			Ω(unsafe.Set(testKey, "db0")).Should(Succeed())
+			Ω(unsafe.SwapDB(0, 1)).Should(Succeed())
+			Ω(unsafe.Exists(testKey)).Should(BeFalse())
+			Ω(unsafe.SwapDB(0, 1)).Should(Succeed())
+			Ω(unsafe.Get(testKey)).Should(Equal("db0"))
+		})
+
+		It("should fail a Select'd Wredis whose DB was swapped", func() {
+			db1, err := unsafe.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			db2, err := unsafe.Select(2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(db1.Set(testKey, "db1")).Should(Succeed())
+
+			Ω(unsafe.SwapDB(1, 3)).Should(Succeed())
+			_, err = db1.Get(testKey)
+			Ω(errors.Is(err, ErrDBSwapped)).Should(BeTrue())
+			_, err = db1.Exists(testKey)
+			Ω(errors.Is(err, ErrDBSwapped)).Should(BeTrue())
+			_, err = db1.Del(testKey)
+			Ω(errors.Is(err, ErrDBSwapped)).Should(BeTrue())
+			_, err = db1.Keys("*")
+			Ω(errors.Is(err, ErrDBSwapped)).Should(BeTrue())
+			Ω(db2.Ping()).Should(Equal("PONG"))
+
+			// Select acknowledges the swap
+			db, err := unsafe.Select(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(db).Should(BeIdenticalTo(db1))
+			Ω(db1.Exists(testKey)).Should(BeFalse())
+		})
+	})
 })
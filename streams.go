@@ -0,0 +1,851 @@
+package wredis
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// StreamEntry is an entry of a stream. The Fields of an entry which has been
+// deleted, but is still pending in a consumer group, are nil.
+type StreamEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+// XTrimOptions are the options of XTrim, which trims a stream by either MaxLen
+// or MinID. As the XAdd option, the zero value doesn't trim.
+type XTrimOptions struct {
+	// MaxLen trims the stream to at most MaxLen entries
+	MaxLen int64
+	// MinID trims the entries with IDs lower than MinID
+	MinID string
+	// Approx trims using "~", which is more efficient but may leave more
+	// entries than requested
+	Approx bool
+	// Limit is the most entries to trim when Approx, 0 is Redis' default
+	Limit int64
+}
+
+// trims returns true if the options trim the stream
+func (o XTrimOptions) trims() bool {
+	return o.MaxLen > 0 || o.MinID != ""
+}
+
+// args appends the trimming arguments
+func (o XTrimOptions) args(args redis.Args) (redis.Args, error) {
+	if o.MaxLen < 0 {
+		return nil, errors.New("wredis: invalid maxlen")
+	}
+	if o.MaxLen > 0 && o.MinID != "" {
+		return nil, errors.New("wredis: maxlen and minid are exclusive")
+	}
+	if o.Limit < 0 || (o.Limit > 0 && !o.Approx) {
+		return nil, errors.New("wredis: invalid trim limit")
+	}
+
+	if o.MaxLen > 0 {
+		args = args.Add("MAXLEN")
+	} else {
+		args = args.Add("MINID")
+	}
+	if o.Approx {
+		args = args.Add("~")
+	}
+	if o.MaxLen > 0 {
+		args = args.Add(o.MaxLen)
+	} else {
+		args = args.Add(o.MinID)
+	}
+	if o.Limit > 0 {
+		args = args.Add("LIMIT", o.Limit)
+	}
+	return args, nil
+}
+
+// XAddOptions are the options of XAdd
+type XAddOptions struct {
+	// ID is the entry's ID, generated by Redis ("*") if empty
+	ID string
+	// NoMkStream doesn't create the stream if it doesn't exist
+	NoMkStream bool
+	// Trim trims the stream once the entry is added
+	Trim XTrimOptions
+}
+
+// XAdd appends an entry of the fields to the stream, returning its ID; which
+// is empty if NoMkStream is set, and the stream doesn't exist.
+//
+// See: https://redis.io/commands/xadd
+func (w *impl) XAdd(stream string, fields map[string]string, opts XAddOptions) (string, error) {
+	if empty(stream) {
+		return stringErr("wredis: empty key")
+	}
+	if len(fields) == 0 {
+		return stringErr("wredis: no fields")
+	}
+
+	args := redis.Args{}.Add(stream)
+	if opts.NoMkStream {
+		args = args.Add("NOMKSTREAM")
+	}
+	if opts.Trim.trims() {
+		var err error
+		if args, err = opts.Trim.args(args); err != nil {
+			return "", err
+		}
+	}
+	id := opts.ID
+	if id == "" {
+		id = "*"
+	}
+	args = args.Add(id)
+
+	// add the fields in order, so the entry is the same however it's built
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = args.Add(name, fields[name])
+	}
+
+	return w.String(func(conn redis.Conn) (string, error) {
+		id, err := redis.String(conn.Do("XADD", args...))
+		if err == redis.ErrNil {
+			return "", nil
+		}
+		return id, err
+	})
+}
+
+// XRange returns the entries of the stream with IDs between start and end
+// (inclusive), which default to "-" and "+" (the first and last IDs) if empty.
+// If count is > 0 at most count entries are returned.
+//
+// See: https://redis.io/commands/xrange
+func (w *impl) XRange(stream, start, end string, count int) ([]StreamEntry, error) {
+	return w.xrange("XRANGE", stream, start, "-", end, "+", count)
+}
+
+// XRevRange returns the entries of the stream with IDs between end and start
+// (inclusive), in reverse order; where end and start default to "+" and "-"
+// (the last and first IDs) if empty. If count is > 0 at most count entries are
+// returned.
+//
+// See: https://redis.io/commands/xrevrange
+func (w *impl) XRevRange(stream, end, start string, count int) ([]StreamEntry, error) {
+	return w.xrange("XREVRANGE", stream, end, "+", start, "-", count)
+}
+
+// xrange sends XRANGE or XREVRANGE, defaulting the empty IDs
+func (w *impl) xrange(cmd, stream, from, fromDefault, to, toDefault string, count int) ([]StreamEntry, error) {
+	if empty(stream) {
+		return nil, errors.New("wredis: empty key")
+	}
+	if count < 0 {
+		return nil, errors.New("wredis: invalid count")
+	}
+	if from == "" {
+		from = fromDefault
+	}
+	if to == "" {
+		to = toDefault
+	}
+
+	args := redis.Args{}.Add(stream, from, to)
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+	var entries []StreamEntry
+	err := w.with(func(conn redis.Conn) (err error) {
+		entries, err = streamEntries(conn.Do(cmd, args...))
+		return err
+	})
+	return entries, err
+}
+
+// XReadOptions are the options of XRead
+type XReadOptions struct {
+	// Count is the most entries to return from each stream, if > 0
+	Count int
+	// Block is how long to wait for entries, if none are available, if > 0
+	Block time.Duration
+}
+
+// XRead returns the entries of the streams with IDs greater than the IDs the
+// streams map to; where "$", or an empty ID, is the stream's last ID, so only
+// new entries are returned. It blocks up to Block waiting for entries, on a
+// connection of its own; returning no streams if there are still none.
+//
+// See: https://redis.io/commands/xread
+func (w *impl) XRead(streams map[string]string, opts XReadOptions) (map[string][]StreamEntry, error) {
+	if len(streams) == 0 {
+		return nil, errors.New("wredis: no streams")
+	}
+	if opts.Count < 0 {
+		return nil, errors.New("wredis: invalid count")
+	}
+	if opts.Block < 0 {
+		return nil, errors.New("wredis: invalid block")
+	}
+
+	args := redis.Args{}
+	if opts.Count > 0 {
+		args = args.Add("COUNT", opts.Count)
+	}
+	if opts.Block > 0 {
+		args = args.Add("BLOCK", blockMillis(opts.Block))
+	}
+	args, err := streamsArgs(args, streams)
+	if err != nil {
+		return nil, err
+	}
+
+	var read map[string][]StreamEntry
+	err = w.with(func(conn redis.Conn) (err error) {
+		read, err = w.readStreams(conn.Do("XREAD", args...))
+		return err
+	})
+	return read, err
+}
+
+// blockMillis returns the BLOCK timeout in milliseconds, which is at least 1;
+// as 0 would block forever
+func blockMillis(block time.Duration) int64 {
+	if ms := block.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// streamsArgs appends the STREAMS argument, of the sorted streams then their
+// IDs, where an empty ID is "$"
+func streamsArgs(args redis.Args, streams map[string]string) (redis.Args, error) {
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		if empty(name) {
+			return nil, errors.New("wredis: empty key")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args = args.Add("STREAMS").AddFlat(names)
+	for _, name := range names {
+		id := streams[name]
+		if id == "" {
+			id = "$"
+		}
+		args = args.Add(id)
+	}
+	return args, nil
+}
+
+// readStreams parses the reply of XREAD or XREADGROUP: an array of stream
+// name & entries pairs in RESP2, or a map of them in RESP3; which is nil if
+// the command timed out. The KeyPrefix is removed from the stream names.
+func (w *impl) readStreams(reply interface{}, err error) (map[string][]StreamEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	read := make(map[string][]StreamEntry)
+	if reply == nil {
+		return read, nil
+	}
+
+	add := func(name string, reply interface{}) error {
+		entries, err := streamEntries(reply, nil)
+		if err != nil {
+			return err
+		}
+		read[strings.TrimPrefix(name, w.cfg.KeyPrefix)] = entries
+		return nil
+	}
+
+	if m, ok := reply.(Map); ok {
+		for name, entries := range m {
+			if err = add(name, entries); err != nil {
+				return nil, err
+			}
+		}
+		return read, nil
+	}
+
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		pair, err := redis.Values(stream, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, errors.New("wredis: invalid streams reply")
+		}
+		name, err := redis.String(pair[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = add(name, pair[1]); err != nil {
+			return nil, err
+		}
+	}
+	return read, nil
+}
+
+// XTrim trims the stream, returning the number of entries deleted.
+//
+// See: https://redis.io/commands/xtrim
+func (w *impl) XTrim(stream string, opts XTrimOptions) (int64, error) {
+	if empty(stream) {
+		return int64Err("wredis: empty key")
+	}
+	if !opts.trims() {
+		return int64Err("wredis: no maxlen or minid")
+	}
+	args, err := opts.args(redis.Args{}.Add(stream))
+	if err != nil {
+		return 0, err
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("XTRIM", args...))
+	})
+}
+
+// XLen returns the number of entries in the stream.
+//
+// See: https://redis.io/commands/xlen
+func (w *impl) XLen(stream string) (int64, error) {
+	if empty(stream) {
+		return int64Err("wredis: empty key")
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		return redis.Int64(conn.Do("XLEN", stream))
+	})
+}
+
+// XDel deletes the entries from the stream, returning the number deleted.
+//
+// See: https://redis.io/commands/xdel
+func (w *impl) XDel(stream string, ids ...string) (int64, error) {
+	if empty(stream) {
+		return int64Err("wredis: empty key")
+	}
+	if len(ids) == 0 {
+		return int64Err("wredis: no ids")
+	}
+	if any(ids, empty) {
+		return int64Err("wredis: empty ids")
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		args := redis.Args{}.Add(stream).AddFlat(ids)
+		return redis.Int64(conn.Do("XDEL", args...))
+	})
+}
+
+// StreamInfo is the information about a stream returned by XInfoStream. The
+// fields which the server doesn't report (e.g. EntriesAdded before Redis 7)
+// are zero.
+type StreamInfo struct {
+	Length            int64
+	RadixTreeKeys     int64
+	RadixTreeNodes    int64
+	Groups            int64
+	LastGeneratedID   string
+	MaxDeletedEntryID string
+	EntriesAdded      int64
+	FirstEntry        *StreamEntry
+	LastEntry         *StreamEntry
+}
+
+// XInfoStream returns information about the stream.
+//
+// See: https://redis.io/commands/xinfo-stream
+func (w *impl) XInfoStream(stream string) (StreamInfo, error) {
+	if empty(stream) {
+		return StreamInfo{}, errors.New("wredis: empty key")
+	}
+
+	var info StreamInfo
+	err := w.with(func(conn redis.Conn) error {
+		m, err := replyMap(conn.Do("XINFO", "STREAM", stream))
+		if err != nil {
+			return err
+		}
+		info = StreamInfo{
+			Length:            mapInt64(m, "length"),
+			RadixTreeKeys:     mapInt64(m, "radix-tree-keys"),
+			RadixTreeNodes:    mapInt64(m, "radix-tree-nodes"),
+			Groups:            mapInt64(m, "groups"),
+			LastGeneratedID:   mapString(m, "last-generated-id"),
+			MaxDeletedEntryID: mapString(m, "max-deleted-entry-id"),
+			EntriesAdded:      mapInt64(m, "entries-added"),
+		}
+		for name, entry := range map[string]**StreamEntry{
+			"first-entry": &info.FirstEntry,
+			"last-entry":  &info.LastEntry,
+		} {
+			if m[name] == nil {
+				continue
+			}
+			e, err := streamEntry(m[name])
+			if err != nil {
+				return err
+			}
+			*entry = &e
+		}
+		return nil
+	})
+	return info, err
+}
+
+// StreamGroupInfo is the information about a consumer group returned by
+// XInfoGroups. EntriesRead and Lag are -1 if the server doesn't know them.
+type StreamGroupInfo struct {
+	Name            string
+	Consumers       int64
+	Pending         int64
+	LastDeliveredID string
+	EntriesRead     int64
+	Lag             int64
+}
+
+// XInfoGroups returns information about the consumer groups of the stream.
+//
+// See: https://redis.io/commands/xinfo-groups
+func (w *impl) XInfoGroups(stream string) ([]StreamGroupInfo, error) {
+	if empty(stream) {
+		return nil, errors.New("wredis: empty key")
+	}
+
+	var groups []StreamGroupInfo
+	err := w.with(func(conn redis.Conn) error {
+		replies, err := redis.Values(conn.Do("XINFO", "GROUPS", stream))
+		if err != nil {
+			return err
+		}
+		groups = make([]StreamGroupInfo, len(replies))
+		for i, reply := range replies {
+			m, err := replyMap(reply, nil)
+			if err != nil {
+				return err
+			}
+			groups[i] = StreamGroupInfo{
+				Name:            mapString(m, "name"),
+				Consumers:       mapInt64(m, "consumers"),
+				Pending:         mapInt64(m, "pending"),
+				LastDeliveredID: mapString(m, "last-delivered-id"),
+				EntriesRead:     -1,
+				Lag:             -1,
+			}
+			if m["entries-read"] != nil {
+				groups[i].EntriesRead = mapInt64(m, "entries-read")
+			}
+			if m["lag"] != nil {
+				groups[i].Lag = mapInt64(m, "lag")
+			}
+		}
+		return nil
+	})
+	return groups, err
+}
+
+// streamEntries parses an array of stream entries
+func streamEntries(reply interface{}, err error) ([]StreamEntry, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]StreamEntry, len(values))
+	for i, value := range values {
+		if entries[i], err = streamEntry(value); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// streamEntry parses a stream entry: its ID, then its fields as a flat array
+// of names and values; which is nil if the entry has been deleted.
+func streamEntry(reply interface{}) (StreamEntry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil || len(values) != 2 {
+		return StreamEntry{}, errors.New("wredis: invalid stream entry")
+	}
+	id, err := redis.String(values[0], nil)
+	if err != nil {
+		return StreamEntry{}, err
+	}
+	entry := StreamEntry{ID: id}
+	if values[1] != nil {
+		if entry.Fields, err = StringMap(values[1], nil); err != nil {
+			return StreamEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// replyMap converts a map reply into a Map. It accepts both RESP3 maps, and
+// the flat key/value arrays RESP2 returns for the same commands.
+func replyMap(reply interface{}, err error) (Map, error) {
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := reply.(Map); ok {
+		return m, nil
+	}
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("wredis: expects even number of values result")
+	}
+	m := make(Map, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		m[mapKey(values[i])] = values[i+1]
+	}
+	return m, nil
+}
+
+// mapInt64 returns the integer value of the Map's key, or 0
+func mapInt64(m Map, key string) int64 {
+	n, _ := redis.Int64(m[key], nil)
+	return n
+}
+
+// mapString returns the string value of the Map's key, or ""
+func mapString(m Map, key string) string {
+	s, _ := stringValue(m[key])
+	return s
+}
+
+// XGroupCreate creates the consumer group of the stream, which starts reading
+// after the ID; where "$", or an empty ID, is the stream's last ID. With
+// mkStream, the stream is created if it doesn't exist.
+//
+// See: https://redis.io/commands/xgroup-create
+func (w *impl) XGroupCreate(stream, group, id string, mkStream bool) error {
+	if empty(stream) {
+		return errors.New("wredis: empty key")
+	}
+	if empty(group) {
+		return errors.New("wredis: empty group")
+	}
+	if id == "" {
+		id = "$"
+	}
+	args := redis.Args{}.Add("CREATE", stream, group, id)
+	if mkStream {
+		args = args.Add("MKSTREAM")
+	}
+	return w.ok("XGroupCreate", func(conn redis.Conn) (string, error) {
+		return redis.String(conn.Do("XGROUP", args...))
+	})
+}
+
+// XReadGroupOptions are the options of XReadGroup
+type XReadGroupOptions struct {
+	// Count is the most entries to return from each stream, if > 0
+	Count int
+	// Block is how long to wait for entries, if none are available, if > 0
+	Block time.Duration
+	// NoAck doesn't add the entries to the group's pending entries, so they
+	// needn't be acknowledged
+	NoAck bool
+}
+
+// XReadGroup returns the entries of the streams for the consumer of the group,
+// with IDs greater than the IDs the streams map to; where ">", or an empty ID,
+// are the entries never delivered to any consumer, and any other ID reads the
+// consumer's pending entries. It blocks up to Block waiting for entries, on a
+// connection of its own; returning no streams if there are still none.
+//
+// See: https://redis.io/commands/xreadgroup
+func (w *impl) XReadGroup(group, consumer string, streams map[string]string, opts XReadGroupOptions) (map[string][]StreamEntry, error) {
+	if empty(group) {
+		return nil, errors.New("wredis: empty group")
+	}
+	if empty(consumer) {
+		return nil, errors.New("wredis: empty consumer")
+	}
+	if len(streams) == 0 {
+		return nil, errors.New("wredis: no streams")
+	}
+	if opts.Count < 0 {
+		return nil, errors.New("wredis: invalid count")
+	}
+	if opts.Block < 0 {
+		return nil, errors.New("wredis: invalid block")
+	}
+
+	args := redis.Args{}.Add("GROUP", group, consumer)
+	if opts.Count > 0 {
+		args = args.Add("COUNT", opts.Count)
+	}
+	if opts.Block > 0 {
+		args = args.Add("BLOCK", blockMillis(opts.Block))
+	}
+	if opts.NoAck {
+		args = args.Add("NOACK")
+	}
+	ids := make(map[string]string, len(streams))
+	for name, id := range streams {
+		if id == "" {
+			id = ">"
+		}
+		ids[name] = id
+	}
+	args, err := streamsArgs(args, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var read map[string][]StreamEntry
+	err = w.with(func(conn redis.Conn) (err error) {
+		read, err = w.readStreams(conn.Do("XREADGROUP", args...))
+		return err
+	})
+	return read, err
+}
+
+// XAck acknowledges the entries of the group, removing them from its pending
+// entries; returning the number acknowledged.
+//
+// See: https://redis.io/commands/xack
+func (w *impl) XAck(stream, group string, ids ...string) (int64, error) {
+	if empty(stream) {
+		return int64Err("wredis: empty key")
+	}
+	if empty(group) {
+		return int64Err("wredis: empty group")
+	}
+	if len(ids) == 0 {
+		return int64Err("wredis: no ids")
+	}
+	if any(ids, empty) {
+		return int64Err("wredis: empty ids")
+	}
+	return w.Int64(func(conn redis.Conn) (int64, error) {
+		args := redis.Args{}.Add(stream, group).AddFlat(ids)
+		return redis.Int64(conn.Do("XACK", args...))
+	})
+}
+
+// PendingSummary summarises the pending entries of a consumer group: their
+// Count, the Lowest and Highest of their IDs, and the Count of each consumer.
+type PendingSummary struct {
+	Count     int64
+	Lowest    string
+	Highest   string
+	Consumers map[string]int64
+}
+
+// XPending returns a summary of the pending entries of the group.
+//
+// See: https://redis.io/commands/xpending
+func (w *impl) XPending(stream, group string) (PendingSummary, error) {
+	if empty(stream) {
+		return PendingSummary{}, errors.New("wredis: empty key")
+	}
+	if empty(group) {
+		return PendingSummary{}, errors.New("wredis: empty group")
+	}
+
+	var summary PendingSummary
+	err := w.with(func(conn redis.Conn) error {
+		values, err := redis.Values(conn.Do("XPENDING", stream, group))
+		if err != nil {
+			return err
+		}
+		if len(values) != 4 {
+			return errors.New("wredis: invalid pending reply")
+		}
+		summary.Count, _ = redis.Int64(values[0], nil)
+		summary.Lowest, _ = redis.String(values[1], nil)
+		summary.Highest, _ = redis.String(values[2], nil)
+		summary.Consumers = make(map[string]int64)
+		consumers, _ := redis.Values(values[3], nil)
+		for _, consumer := range consumers {
+			pair, err := redis.Values(consumer, nil)
+			if err != nil || len(pair) != 2 {
+				return errors.New("wredis: invalid pending reply")
+			}
+			name, _ := redis.String(pair[0], nil)
+			// the counts are strings in RESP2, and integers in RESP3
+			count, err := redis.Int64(pair[1], nil)
+			if err != nil {
+				return err
+			}
+			summary.Consumers[name] = count
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// PendingEntry is a pending entry of a consumer group: its ID, the Consumer
+// it was last delivered to, how long ago (Idle), and the number of times it's
+// been delivered.
+type PendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+// XPendingOptions are the options of XPendingExt
+type XPendingOptions struct {
+	// Start and End are the range of IDs, which default to "-" and "+"
+	Start, End string
+	// Count is the most entries to return, which must be > 0
+	Count int
+	// Consumer only returns the entries pending for the consumer, if set
+	Consumer string
+	// Idle only returns the entries idle for at least Idle, if > 0
+	Idle time.Duration
+}
+
+// XPendingExt returns the pending entries of the group.
+//
+// See: https://redis.io/commands/xpending
+func (w *impl) XPendingExt(stream, group string, opts XPendingOptions) ([]PendingEntry, error) {
+	if empty(stream) {
+		return nil, errors.New("wredis: empty key")
+	}
+	if empty(group) {
+		return nil, errors.New("wredis: empty group")
+	}
+	if opts.Count <= 0 {
+		return nil, errors.New("wredis: invalid count")
+	}
+	if opts.Idle < 0 {
+		return nil, errors.New("wredis: invalid idle")
+	}
+	if opts.Start == "" {
+		opts.Start = "-"
+	}
+	if opts.End == "" {
+		opts.End = "+"
+	}
+
+	args := redis.Args{}.Add(stream, group)
+	if opts.Idle > 0 {
+		args = args.Add("IDLE", opts.Idle.Milliseconds())
+	}
+	args = args.Add(opts.Start, opts.End, opts.Count)
+	if opts.Consumer != "" {
+		args = args.Add(opts.Consumer)
+	}
+
+	var pending []PendingEntry
+	err := w.with(func(conn redis.Conn) error {
+		values, err := redis.Values(conn.Do("XPENDING", args...))
+		if err != nil {
+			return err
+		}
+		pending = make([]PendingEntry, len(values))
+		for i, value := range values {
+			var idle int64
+			entry, err := redis.Values(value, nil)
+			if err == nil {
+				_, err = redis.Scan(entry, &pending[i].ID, &pending[i].Consumer, &idle, &pending[i].Deliveries)
+			}
+			if err != nil {
+				return errors.New("wredis: invalid pending reply")
+			}
+			pending[i].Idle = time.Duration(idle) * time.Millisecond
+		}
+		return nil
+	})
+	return pending, err
+}
+
+// XClaim changes the consumer of the group's pending entries, which have been
+// idle for at least minIdle, to the consumer; returning the entries claimed.
+//
+// See: https://redis.io/commands/xclaim
+func (w *impl) XClaim(stream, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	if err := validateClaim(stream, group, consumer, minIdle); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("wredis: no ids")
+	}
+	if any(ids, empty) {
+		return nil, errors.New("wredis: empty ids")
+	}
+
+	args := redis.Args{}.Add(stream, group, consumer, minIdle.Milliseconds()).AddFlat(ids)
+	var entries []StreamEntry
+	err := w.with(func(conn redis.Conn) (err error) {
+		entries, err = streamEntries(conn.Do("XCLAIM", args...))
+		return err
+	})
+	return entries, err
+}
+
+// XAutoClaim claims up to count of the group's pending entries, from the start
+// ID, which have been idle for at least minIdle; as XClaim. It returns the ID
+// to start the next call from, which is "0-0" once every entry's been checked.
+//
+// See: https://redis.io/commands/xautoclaim
+func (w *impl) XAutoClaim(stream, group, consumer string, minIdle time.Duration, start string, count int) (string, []StreamEntry, error) {
+	if err := validateClaim(stream, group, consumer, minIdle); err != nil {
+		return "", nil, err
+	}
+	if count < 0 {
+		return "", nil, errors.New("wredis: invalid count")
+	}
+	if start == "" {
+		start = "0-0"
+	}
+
+	args := redis.Args{}.Add(stream, group, consumer, minIdle.Milliseconds(), start)
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+	var (
+		next    string
+		entries []StreamEntry
+	)
+	err := w.with(func(conn redis.Conn) error {
+		// Redis 7 replies with a third element, the IDs of deleted entries
+		values, err := redis.Values(conn.Do("XAUTOCLAIM", args...))
+		if err != nil {
+			return err
+		}
+		if len(values) < 2 {
+			return errors.New("wredis: invalid autoclaim reply")
+		}
+		if next, err = redis.String(values[0], nil); err != nil {
+			return err
+		}
+		entries, err = streamEntries(values[1], nil)
+		return err
+	})
+	return next, entries, err
+}
+
+// validateClaim validates the arguments of XClaim and XAutoClaim
+func validateClaim(stream, group, consumer string, minIdle time.Duration) error {
+	if empty(stream) {
+		return errors.New("wredis: empty key")
+	}
+	if empty(group) {
+		return errors.New("wredis: empty group")
+	}
+	if empty(consumer) {
+		return errors.New("wredis: empty consumer")
+	}
+	if minIdle < 0 {
+		return errors.New("wredis: invalid min idle")
+	}
+	return nil
+}
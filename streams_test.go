@@ -0,0 +1,257 @@
+package wredis_test
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streams", func() {
+	testStream := "wredis::test::stream"
+	otherStream := "wredis::test::stream2"
+
+	BeforeEach(func() {
+		unsafe.Del(testStream, otherStream)
+	})
+
+	// add adds the entries to the stream, with IDs 1-1, 2-1, ...
+	add := func(stream string, values ...string) {
+		for i, value := range values {
+			_, err := safe.XAdd(stream, map[string]string{"v": value}, XAddOptions{
+				ID: strconv.Itoa(i+1) + "-1",
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	}
+
+	ids := func(entries []StreamEntry) []string {
+		ids := make([]string, len(entries))
+		for i, e := range entries {
+			ids[i] = e.ID
+		}
+		return ids
+	}
+
+	Context("XAdd", func() {
+		It("should fail given an invalid stream or fields", func() {
+			_, err := safe.XAdd("", map[string]string{"a": "1"}, XAddOptions{})
+			Ω(err).Should(MatchError("wredis: empty key"))
+			_, err = safe.XAdd(testStream, nil, XAddOptions{})
+			Ω(err).Should(MatchError("wredis: no fields"))
+			_, err = safe.XAdd(testStream, map[string]string{"a": "1"}, XAddOptions{
+				Trim: XTrimOptions{MaxLen: 1, MinID: "1-1"},
+			})
+			Ω(err).Should(MatchError("wredis: maxlen and minid are exclusive"))
+		})
+
+		It("should add entries, generating their IDs", func() {
+			id, err := safe.XAdd(testStream, map[string]string{"a": "1", "b": "2"}, XAddOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(id).ShouldNot(BeEmpty())
+
+			entries, err := safe.XRange(testStream, "", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]StreamEntry{
+				{ID: id, Fields: map[string]string{"a": "1", "b": "2"}},
+			}))
+		})
+
+		It("should not create the stream with NoMkStream", func() {
+			id, err := safe.XAdd(testStream, map[string]string{"a": "1"}, XAddOptions{NoMkStream: true})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(id).Should(BeEmpty())
+			Ω(safe.Exists(testStream)).Should(BeFalse())
+		})
+
+		It("should trim the stream", func() {
+			add(testStream, "a", "b", "c")
+			_, err := safe.XAdd(testStream, map[string]string{"v": "d"}, XAddOptions{
+				ID:   "4-1",
+				Trim: XTrimOptions{MaxLen: 2},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			entries, err := safe.XRange(testStream, "", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(entries)).Should(Equal([]string{"3-1", "4-1"}))
+
+			_, err = safe.XAdd(testStream, map[string]string{"v": "e"}, XAddOptions{
+				ID:   "5-1",
+				Trim: XTrimOptions{MinID: "5-0"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(safe.XLen(testStream)).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("XRange & XRevRange", func() {
+		BeforeEach(func() {
+			add(testStream, "a", "b", "c")
+		})
+
+		It("should fail given an invalid stream or count", func() {
+			_, err := safe.XRange("", "", "", 0)
+			Ω(err).Should(MatchError("wredis: empty key"))
+			_, err = safe.XRevRange(testStream, "", "", -1)
+			Ω(err).Should(MatchError("wredis: invalid count"))
+		})
+
+		It("should return the entries between the IDs", func() {
+			entries, err := safe.XRange(testStream, "2-1", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(entries)).Should(Equal([]string{"2-1", "3-1"}))
+			Ω(entries[0].Fields).Should(Equal(map[string]string{"v": "b"}))
+
+			entries, err = safe.XRange(testStream, "", "", 2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(entries)).Should(Equal([]string{"1-1", "2-1"}))
+		})
+
+		It("should return the entries in reverse", func() {
+			entries, err := safe.XRevRange(testStream, "", "", 2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(entries)).Should(Equal([]string{"3-1", "2-1"}))
+
+			entries, err = safe.XRevRange(testStream, "2-1", "1-1", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(entries)).Should(Equal([]string{"2-1", "1-1"}))
+		})
+
+		It("should return no entries for a stream which doesn't exist", func() {
+			entries, err := safe.XRange(otherStream, "", "", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(BeEmpty())
+		})
+	})
+
+	Context("XRead", func() {
+		It("should fail given invalid streams or options", func() {
+			_, err := safe.XRead(nil, XReadOptions{})
+			Ω(err).Should(MatchError("wredis: no streams"))
+			_, err = safe.XRead(map[string]string{"": "0"}, XReadOptions{})
+			Ω(err).Should(MatchError("wredis: empty key"))
+			_, err = safe.XRead(map[string]string{testStream: "0"}, XReadOptions{Block: -1})
+			Ω(err).Should(MatchError("wredis: invalid block"))
+		})
+
+		It("should read the entries after the IDs", func() {
+			add(testStream, "a", "b", "c")
+			add(otherStream, "d")
+
+			read, err := safe.XRead(map[string]string{testStream: "1-1", otherStream: "0"}, XReadOptions{Count: 1})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read).Should(HaveLen(2))
+			Ω(read[testStream]).Should(Equal([]StreamEntry{{ID: "2-1", Fields: map[string]string{"v": "b"}}}))
+			Ω(ids(read[otherStream])).Should(Equal([]string{"1-1"}))
+		})
+
+		It("should block until there are new entries", func() {
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(50 * time.Millisecond)
+				_, err := safe.XAdd(testStream, map[string]string{"v": "new"}, XAddOptions{})
+				Ω(err).ShouldNot(HaveOccurred())
+			}()
+
+			read, err := safe.XRead(map[string]string{testStream: "$"}, XReadOptions{Block: 5 * time.Second})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read[testStream]).Should(HaveLen(1))
+			Ω(read[testStream][0].Fields).Should(Equal(map[string]string{"v": "new"}))
+		})
+
+		It("should return no streams once the block times out", func() {
+			add(testStream, "a")
+			read, err := safe.XRead(map[string]string{testStream: ""}, XReadOptions{Block: 20 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read).Should(BeEmpty())
+		})
+
+		It("should read the stream names without the KeyPrefix", func() {
+			w, err := Safe(KeyPrefix("wredis::test::"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+			add(testStream, "a")
+
+			read, err := w.XRead(map[string]string{"stream": "0"}, XReadOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ids(read["stream"])).Should(Equal([]string{"1-1"}))
+		})
+	})
+
+	Context("XTrim, XLen & XDel", func() {
+		BeforeEach(func() {
+			add(testStream, "a", "b", "c", "d")
+		})
+
+		It("should fail without a trimming strategy", func() {
+			_, err := safe.XTrim(testStream, XTrimOptions{})
+			Ω(err).Should(MatchError("wredis: no maxlen or minid"))
+			_, err = safe.XTrim(testStream, XTrimOptions{MaxLen: 1, Limit: 10})
+			Ω(err).Should(MatchError("wredis: invalid trim limit"))
+		})
+
+		It("should trim the stream", func() {
+			Ω(safe.XTrim(testStream, XTrimOptions{MaxLen: 3})).Should(BeEquivalentTo(1))
+			Ω(safe.XTrim(testStream, XTrimOptions{MinID: "4-0"})).Should(BeEquivalentTo(2))
+			Ω(safe.XLen(testStream)).Should(BeEquivalentTo(1))
+		})
+
+		It("should delete entries", func() {
+			_, err := safe.XDel(testStream)
+			Ω(err).Should(MatchError("wredis: no ids"))
+
+			Ω(safe.XDel(testStream, "1-1", "3-1", "9-1")).Should(BeEquivalentTo(2))
+			Ω(safe.XLen(testStream)).Should(BeEquivalentTo(2))
+			Ω(safe.XLen(otherStream)).Should(BeZero())
+		})
+	})
+
+	Context("XInfo", func() {
+		BeforeEach(func() {
+			add(testStream, "a", "b")
+		})
+
+		It("should return the stream's information", func() {
+			info, err := safe.XInfoStream(testStream)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.Length).Should(BeEquivalentTo(2))
+			Ω(info.LastGeneratedID).Should(Equal("2-1"))
+
+			_, err = safe.XInfoStream(otherStream)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return the stream's groups", func() {
+			groups, err := safe.XInfoGroups(testStream)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(BeEmpty())
+
+			_, err = safe.Do("XGROUP", "CREATE", testStream, "group", "0")
+			Ω(err).ShouldNot(HaveOccurred())
+			groups, err = safe.XInfoGroups(testStream)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(HaveLen(1))
+			Ω(groups[0].Name).Should(Equal("group"))
+			Ω(groups[0].Pending).Should(BeZero())
+			Ω(groups[0].EntriesRead).Should(BeEquivalentTo(-1))
+		})
+
+		It("should parse RESP3 replies", func() {
+			w, err := Safe(Protocol(3))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			info, err := w.XInfoStream(testStream)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.Length).Should(BeEquivalentTo(2))
+			Ω(info.LastGeneratedID).Should(Equal("2-1"))
+
+			read, err := w.XRead(map[string]string{testStream: "1-1"}, XReadOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read[testStream]).Should(Equal([]StreamEntry{{ID: "2-1", Fields: map[string]string{"v": "b"}}}))
+		})
+	})
+})
@@ -36,9 +36,53 @@ func (w *impl) Get(key string) (string, error) {
 	if empty(key) {
 		return stringErr("wredis: empty key")
 	}
-	return w.String(func(conn redis.Conn) (string, error) {
-		return redis.String(conn.Do("GET", key))
-	})
+	if !w.cfg.native {
+		return w.String(func(conn redis.Conn) (string, error) {
+			return redis.String(conn.Do("GET", key))
+		})
+	}
+
+	call := getCall(callBulk, key)
+	defer putCall(call)
+	if err := w.call("GET", call); err != nil {
+		return "", err
+	}
+	return string(call.bulk), nil
+}
+
+// GetBytes retrieves the value for some key, appending it to dst[:0] rather
+// than allocating a new slice; so dst can be reused for successive calls. If
+// the key does not exist redis.ErrNil is returned.
+//
+// See: http://redis.io/commands/get
+func (w *impl) GetBytes(key string, dst []byte) ([]byte, error) {
+	if empty(key) {
+		return nil, errors.New("wredis: empty key")
+	}
+	if !w.cfg.native {
+		var p []byte
+		_, err := w.Int(func(conn redis.Conn) (int, error) {
+			b, err := redis.Bytes(conn.Do("GET", key))
+			p = append(dst[:0], b...)
+			return 0, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	call := getCall(callBulk, key)
+	defer putCall(call)
+	bulk := call.bulk
+	call.bulk = dst
+	err := w.call("GET", call)
+	p := call.bulk
+	call.bulk = bulk
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 // MGet returns the values of all provided keys. For a key that does not exist,
@@ -46,13 +90,39 @@ func (w *impl) Get(key string) (string, error) {
 //
 // See: http://redis.io/commands/mget.
 func (w *impl) MGet(keys ...string) ([]string, error) {
+	return w.MGetInto(nil, keys...)
+}
+
+// MGetInto is MGet, but appends the values to dst[:0] rather than allocating a
+// new slice; so dst can be reused for successive calls.
+//
+// See: http://redis.io/commands/mget.
+func (w *impl) MGetInto(dst []string, keys ...string) ([]string, error) {
 	if any(keys, empty) {
 		return stringsErr("wredis: empty keys")
 	}
-	return w.Strings(func(conn redis.Conn) ([]string, error) {
-		args := redis.Args{}.AddFlat(keys)
-		return redis.Strings(conn.Do("MGET", args...))
-	})
+	if !w.cfg.native {
+		return w.Strings(func(conn redis.Conn) ([]string, error) {
+			args := redis.Args{}.AddFlat(keys)
+			ss, err := redis.Strings(conn.Do("MGET", args...))
+			if err != nil {
+				return nil, err
+			}
+			return append(dst[:0], ss...), nil
+		})
+	}
+
+	call := getCall(callStrings, keys...)
+	defer putCall(call)
+	strs := call.strs
+	call.strs = dst
+	err := w.call("MGET", call)
+	ss := call.strs
+	call.strs = strs
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
 }
 
 // Incr increments the number stored at key by one.
@@ -3,6 +3,10 @@ package wredis_test
 import (
 	"time"
 
+	. "github.com/crowdriff/wredis"
+
+	"github.com/garyburd/redigo/redis"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -26,6 +30,41 @@ var _ = Describe("Strings", func() {
 		Ω(val).Should(Equal(testVal))
 	})
 
+	Context("GetBytes", func() {
+		It("should return an error with an empty key provided", func() {
+			_, err := safe.GetBytes("", nil)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: empty key"))
+		})
+
+		It("should GET the value into the provided buffer", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+
+			buf := make([]byte, 0, 64)
+			val, err := safe.GetBytes(testKey, buf)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(val)).Should(Equal(testVal))
+			Ω(&val[0]).Should(Equal(&buf[:1][0]))
+		})
+
+		It("should return ErrNil for a missing key", func() {
+			_, err := safe.GetBytes(testKey, nil)
+			Ω(err).Should(Equal(redis.ErrNil))
+		})
+
+		It("should GET the value using a custom Dialer", func() {
+			Ω(safe.Set(testKey, testVal)).Should(Succeed())
+
+			w, err := Safe(RedigoDialer())
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+
+			val, err := w.GetBytes(testKey, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(val)).Should(Equal(testVal))
+		})
+	})
+
 	Context("MGet", func() {
 		It("should return an error when a key is empty", func() {
 			_, err := safe.MGet("1", "", "3")
@@ -45,6 +84,16 @@ var _ = Describe("Strings", func() {
 			Ω(vals[1]).Should(Equal("two"))
 			Ω(vals[2]).Should(Equal(""))
 		})
+
+		It("should return all values into the provided slice", func() {
+			Ω(safe.Set("1", "one")).Should(Succeed())
+
+			dst := make([]string, 0, 4)
+			vals, err := safe.MGetInto(dst, "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(vals).Should(Equal([]string{"one", ""}))
+			Ω(&vals[0]).Should(Equal(&dst[:1][0]))
+		})
 	})
 
 	Context("Incr", func() {
@@ -0,0 +1,177 @@
+package wredis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS enables TLS connections using the provided *tls.Config. The Config is
+// cloned for every new connection, so it must not be modified after use.
+func TLS(tlsCfg *tls.Config) Option {
+	return func(cfg Config) (Config, error) {
+		if tlsCfg == nil {
+			return cfg, errors.New("wredis: nil tls config")
+		}
+		cfg.TLS = tlsCfg
+		cfg.tlsFiles = nil
+		return cfg, nil
+	}
+}
+
+// TLSFromFiles enables TLS connections using PEM encoded files. The ca file is
+// used to verify the server, when empty the system roots are used. The cert &
+// key files hold the client certificate, and must be provided together or not
+// at all.
+//
+// The files are checked for modifications each time a new connection is
+// dialed, so certificates can be rotated on disk without a restart.
+func TLSFromFiles(ca, cert, key string) Option {
+	return func(cfg Config) (Config, error) {
+		if empty(cert) != empty(key) {
+			return cfg, errors.New("wredis: tls cert and key required")
+		}
+		files := &tlsFiles{ca: ca, cert: cert, key: key}
+		// load the files now; to fail early on bad paths or contents
+		if _, err := files.config(); err != nil {
+			return cfg, err
+		}
+		cfg.TLS = nil
+		cfg.tlsFiles = files
+		return cfg, nil
+	}
+}
+
+// InsecureSkipVerify enables TLS connections, without verifying the server's
+// certificate chain or host name. This should only be used for testing.
+func InsecureSkipVerify(skip bool) Option {
+	return func(cfg Config) (Config, error) {
+		cfg.InsecureSkipVerify = skip
+		return cfg, nil
+	}
+}
+
+// ServerName sets the host name sent via SNI, and used to verify the server
+// certificate. By default the configured Host is used.
+func ServerName(name string) Option {
+	return func(cfg Config) (Config, error) {
+		if empty(name) {
+			return cfg, errors.New("wredis: empty server name")
+		}
+		cfg.ServerName = name
+		return cfg, nil
+	}
+}
+
+// tlsConfig returns the *tls.Config to dial a new connection with, or nil if
+// TLS has not been configured.
+func (c Config) tlsConfig() (*tls.Config, error) {
+	tlsCfg := c.TLS
+	if c.tlsFiles != nil {
+		var err error
+		if tlsCfg, err = c.tlsFiles.config(); err != nil {
+			return nil, err
+		}
+	}
+
+	// TLS is not enabled
+	if tlsCfg == nil && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+	if c.InsecureSkipVerify {
+		tlsCfg.InsecureSkipVerify = true
+	}
+	if c.ServerName != "" {
+		tlsCfg.ServerName = c.ServerName
+	}
+	// a unix socket address has no host to verify against
+	if c.Network == "unix" && tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = c.Host
+	}
+	return tlsCfg, nil
+}
+
+// tlsFiles loads a *tls.Config from PEM encoded files, and reloads it whenever
+// any of the files are modified.
+type tlsFiles struct {
+	ca, cert, key string
+
+	mu      sync.Mutex
+	cfg     *tls.Config // the last loaded config
+	modTime time.Time   // latest modification time of the loaded files
+}
+
+// config returns the current *tls.Config, reloading it if necessary.
+func (f *tlsFiles) config() (*tls.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	modTime, err := f.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if f.cfg != nil && modTime.Equal(f.modTime) {
+		return f.cfg, nil
+	}
+
+	cfg, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	f.cfg, f.modTime = cfg, modTime
+	return cfg, nil
+}
+
+// lastModified returns the latest modification time of the files
+func (f *tlsFiles) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{f.ca, f.cert, f.key} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load reads the files into a new *tls.Config
+func (f *tlsFiles) load() (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	if f.ca != "" {
+		pem, err := ioutil.ReadFile(f.ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("wredis: invalid tls ca")
+		}
+	}
+
+	if f.cert != "" {
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,238 @@
+package wredis_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/crowdriff/wredis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testCert is a generated certificate, and the PEM encoding of it and its key
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func (tc testCert) TLS() tls.Certificate {
+	cert, err := tls.X509KeyPair(tc.certPEM, tc.keyPEM)
+	Ω(err).ShouldNot(HaveOccurred())
+	return cert
+}
+
+func (tc testCert) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(tc.cert)
+	return pool
+}
+
+// newTestCert generates a certificate signed by parent, or a self-signed CA if
+// parent is nil
+func newTestCert(name string, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		DNSNames:    []string{name},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	Ω(err).ShouldNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Ω(err).ShouldNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		ca     testCert
+		server *fakeServer
+		dir    string
+	)
+
+	BeforeEach(func() {
+		ca = newTestCert("wredis-ca", nil)
+		srvCert := newTestCert("redis.test", &ca)
+
+		var err error
+		server, err = newFakeServer(&tls.Config{
+			Certificates: []tls.Certificate{srvCert.TLS()},
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			ClientCAs:    ca.Pool(),
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		dir, err = ioutil.TempDir("", "wredis-tls")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Ω(server.Close()).Should(Succeed())
+		Ω(os.RemoveAll(dir)).Should(Succeed())
+	})
+
+	// writes the contents to a file in the temp dir, returning its path
+	write := func(name string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		Ω(ioutil.WriteFile(path, contents, 0600)).Should(Succeed())
+		return path
+	}
+
+	It("should connect using the provided tls config", func() {
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			TLS(&tls.Config{RootCAs: ca.Pool()}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should verify the server certificate against the server name", func() {
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			TLS(&tls.Config{RootCAs: ca.Pool()}),
+			ServerName("other.test"),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		_, err = w.Ping()
+		Ω(err).Should(HaveOccurred())
+
+		w2, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			TLS(&tls.Config{RootCAs: ca.Pool()}),
+			ServerName("redis.test"),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w2.Close()
+
+		Ω(w2.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should fail to connect to an unknown certificate authority", func() {
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			TLS(&tls.Config{}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		_, err = w.Ping()
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should connect without verification when InsecureSkipVerify", func() {
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			InsecureSkipVerify(true),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should connect using certificates loaded from files", func() {
+		client := newTestCert("client", &ca)
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			TLSFromFiles(
+				write("ca.pem", ca.certPEM),
+				write("cert.pem", client.certPEM),
+				write("key.pem", client.keyPEM),
+			),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should reload the certificates when the files change", func() {
+		other := newTestCert("other-ca", nil)
+		caFile := write("ca.pem", other.certPEM)
+
+		// no idle connections, so every command will dial
+		w, err := Safe(
+			Host("127.0.0.1"),
+			Port(server.Port()),
+			MaxIdle(0),
+			TLSFromFiles(caFile, "", ""),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Close()
+
+		_, err = w.Ping()
+		Ω(err).Should(HaveOccurred())
+
+		// rotate the ca on disk
+		write("ca.pem", ca.certPEM)
+		future := time.Now().Add(time.Minute)
+		Ω(os.Chtimes(caFile, future, future)).Should(Succeed())
+
+		Ω(w.Ping()).Should(Equal("PONG"))
+	})
+
+	It("should fail given invalid files", func() {
+		_, err := Safe(TLSFromFiles(filepath.Join(dir, "missing.pem"), "", ""))
+		Ω(err).Should(HaveOccurred())
+
+		_, err = Safe(TLSFromFiles(write("ca.pem", []byte("nope")), "", ""))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: invalid tls ca"))
+
+		_, err = Safe(TLSFromFiles("", write("cert.pem", ca.certPEM), ""))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("wredis: tls cert and key required"))
+	})
+})
@@ -0,0 +1,167 @@
+package wredis
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseURL parses a Redis connection URL into a Config, using the default
+// Config for any values not specified in the URL. See FromURL for the
+// supported URL formats.
+func ParseURL(rawurl string) (Config, error) {
+	cfg, err := FromURL(rawurl)(defaultConfig())
+	if err != nil {
+		return nilCfg, err
+	}
+	return cfg, nil
+}
+
+// FromURL sets the values in the Config from a Redis connection URL. The
+// following formats are supported:
+//
+//	redis://[[user]:password@]host[:port][/db]
+//	rediss://[[user]:password@]host[:port][/db]
+//	unix://[[user]:password@]/path/to/redis.sock[?db=N]
+//
+// The rediss scheme enables TLS. The pool settings may be set using the
+// max_active, max_idle, idle_timeout, max_conn_lifetime & wait query
+// parameters, where durations are either a time.Duration string or a number
+// of seconds (e.g. ?max_active=20&idle_timeout=5m&wait=true).
+//
+// See: https://www.iana.org/assignments/uri-schemes/prov/redis
+func FromURL(rawurl string) Option {
+	return func(cfg Config) (Config, error) {
+		opts, err := urlOptions(rawurl)
+		if err != nil {
+			return cfg, err
+		}
+		for _, opt := range opts {
+			if cfg, err = opt(cfg); err != nil {
+				return cfg, err
+			}
+		}
+		return cfg, cfg.Validate()
+	}
+}
+
+// urlOptions converts the URL into the equivalent Option(s)
+func urlOptions(rawurl string) ([]Option, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []Option
+	switch u.Scheme {
+	case "redis", "rediss":
+		opts = append(opts, Network("tcp"))
+		if u.Hostname() != "" {
+			opts = append(opts, Host(u.Hostname()))
+		}
+		if u.Port() != "" {
+			port, err := strconv.Atoi(u.Port())
+			if err != nil {
+				return nil, errors.New("wredis: invalid port")
+			}
+			opts = append(opts, Port(port))
+		}
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			n, err := strconv.ParseUint(db, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("wredis: invalid url db %q", db)
+			}
+			opts = append(opts, DB(uint(n)))
+		}
+		if u.Scheme == "rediss" {
+			opts = append(opts, useTLS())
+		}
+	case "unix":
+		opts = append(opts, Socket(u.Path))
+	default:
+		return nil, fmt.Errorf("wredis: invalid url scheme %q", u.Scheme)
+	}
+
+	// credentials
+	if u.User != nil {
+		if user := u.User.Username(); user != "" {
+			opts = append(opts, Username(user))
+		}
+		if pass, _ := u.User.Password(); pass != "" {
+			opts = append(opts, Password(pass))
+		}
+	}
+
+	// query parameters
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		opt, err := urlParam(key, value)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+
+	return opts, nil
+}
+
+// urlParam converts a single URL query parameter into an Option
+func urlParam(key, value string) (Option, error) {
+	invalid := fmt.Errorf("wredis: invalid url parameter %s=%q", key, value)
+
+	switch key {
+	case "db":
+		n, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return nil, invalid
+		}
+		return DB(uint(n)), nil
+	case "max_active", "max_idle":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, invalid
+		}
+		if key == "max_active" {
+			return MaxActive(n), nil
+		}
+		return MaxIdle(n), nil
+	case "idle_timeout", "max_conn_lifetime":
+		d, err := parseDuration(value)
+		if err != nil {
+			return nil, invalid
+		}
+		if key == "idle_timeout" {
+			return IdleTimeout(d), nil
+		}
+		return MaxConnLifetime(d), nil
+	case "wait":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalid
+		}
+		return Wait(b), nil
+	}
+	return nil, fmt.Errorf("wredis: unknown url parameter %q", key)
+}
+
+// parseDuration parses a time.Duration string, or a number of seconds
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// useTLS enables TLS, unless it has already been configured
+func useTLS() Option {
+	return func(cfg Config) (Config, error) {
+		if cfg.TLS == nil && cfg.tlsFiles == nil {
+			cfg.TLS = &tls.Config{}
+		}
+		return cfg, nil
+	}
+}
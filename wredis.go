@@ -1,6 +1,8 @@
 package wredis
 
 import (
+	"context"
+	"io/fs"
 	"time"
 )
 
@@ -20,6 +22,49 @@ type Wredis interface {
 	// See: http://redis.io/commands/flushdb
 	FlushDB() error
 
+	// SwapDB swaps the data of two databases. A Wredis returned by Select for
+	// either DB will fail with ErrDBSwapped, until Select is called again.
+	//
+	// See: https://redis.io/commands/swapdb
+	SwapDB(uint, uint) error
+
+	//
+	// PubSub Commands
+	//
+
+	// Publish posts a message to a channel, returning the number of clients
+	// which received it.
+	//
+	// See: https://redis.io/commands/publish
+	Publish(string, string) (int64, error)
+
+	// Subscribe subscribes to channels, returning a Subscription which receives
+	// their messages until it's closed, or the context is done.
+	//
+	// See: https://redis.io/commands/subscribe
+	Subscribe(context.Context, ...string) (*Subscription, error)
+
+	// PSubscribe subscribes to the channels matching patterns, returning a
+	// Subscription which receives their messages until it's closed, or the
+	// context is done.
+	//
+	// See: https://redis.io/commands/psubscribe
+	PSubscribe(context.Context, ...string) (*Subscription, error)
+
+	// SPublish posts a message to a sharded channel, returning the number of
+	// clients which received it. In Cluster mode, it's sent to the node serving
+	// the channel's slot.
+	//
+	// See: https://redis.io/commands/spublish
+	SPublish(string, string) (int64, error)
+
+	// SSubscribe subscribes to sharded channels, returning a Subscription which
+	// receives their messages until it's closed, or the context is done. In
+	// Cluster mode, it's subscribed on the nodes serving the channels' slots.
+	//
+	// See: https://redis.io/commands/ssubscribe
+	SSubscribe(context.Context, ...string) (*Subscription, error)
+
 	//
 	// Connection Commands
 	//
@@ -44,6 +89,12 @@ type Wredis interface {
 	// See: https://redis.io/commands/select
 	Select(uint) (Wredis, error)
 
+	// DB returns the Wredis for a database which has been opened by Select.
+	DB(uint) (Wredis, bool)
+
+	// OpenDBs returns the databases which have been opened by Select.
+	OpenDBs() []uint
+
 	// selectable returns if we can call Select on this client
 	selectable() bool
 
@@ -77,6 +128,61 @@ type Wredis interface {
 	// See: `http://redis.io/commands/rename`
 	Rename(string, string) error
 
+	// Scan incrementally iterates over the keys matching a pattern, returning
+	// the next cursor; which is 0 once the iteration is complete.
+	//
+	// See: https://redis.io/commands/scan
+	Scan(uint64, string, int) (uint64, []string, error)
+
+	// Copy copies the value of the key "src" to "dst", returning false if the
+	// destination key exists and Replace isn't set.
+	//
+	// See: https://redis.io/commands/copy
+	Copy(string, string, CopyOptions) (bool, error)
+
+	// Move moves a key to the DB, returning false if the key doesn't exist or
+	// already exists in the DB.
+	//
+	// See: https://redis.io/commands/move
+	Move(string, uint) (bool, error)
+
+	//
+	// Bitmaps Commands
+	//
+
+	// SetBit sets or clears a bit of a string, returning its original value.
+	//
+	// See: https://redis.io/commands/setbit
+	SetBit(string, int64, bool) (bool, error)
+
+	// GetBit returns a bit of a string.
+	//
+	// See: https://redis.io/commands/getbit
+	GetBit(string, int64) (bool, error)
+
+	// BitCount returns the number of bits set in a string, optionally within a
+	// range.
+	//
+	// See: https://redis.io/commands/bitcount
+	BitCount(string, *BitRange) (int64, error)
+
+	// BitPos returns the position of the first bit set, or cleared, in a
+	// string; optionally within a range.
+	//
+	// See: https://redis.io/commands/bitpos
+	BitPos(string, bool, *BitRange) (int64, error)
+
+	// BitOp performs a bitwise operation between strings, storing the result.
+	//
+	// See: https://redis.io/commands/bitop
+	BitOp(BitOperation, string, ...string) (int64, error)
+
+	// BitField returns a builder of the operations on the integer fields of a
+	// string, which are run by its Exec.
+	//
+	// See: https://redis.io/commands/bitfield
+	BitField(string) *BitField
+
 	//
 	// Lists Commands
 	//
@@ -96,17 +202,188 @@ type Wredis interface {
 	SMembers(string) ([]string, error)
 	SUnionStore(string, ...string) (int64, error)
 
+	//
+	// HyperLogLog Commands
+	//
+
+	// PFAdd adds elements to a HyperLogLog, returning true if its approximated
+	// cardinality changed.
+	//
+	// See: https://redis.io/commands/pfadd
+	PFAdd(string, ...string) (bool, error)
+
+	// PFCount returns the approximated cardinality of a HyperLogLog, or of the
+	// union of several.
+	//
+	// See: https://redis.io/commands/pfcount
+	PFCount(...string) (int64, error)
+
+	// PFMerge merges HyperLogLogs into a destination key.
+	//
+	// See: https://redis.io/commands/pfmerge
+	PFMerge(string, ...string) error
+
+	//
+	// Scripting Commands
+	//
+
+	// LoadScripts loads the ".lua" files of a file system into the script
+	// cache, returning their Scripts by path.
+	//
+	// See: https://redis.io/commands/script-load
+	LoadScripts(fs.FS) (map[string]*Script, error)
+
+	// FunctionLoad loads a library of functions, returning its name.
+	//
+	// See: https://redis.io/commands/function-load
+	FunctionLoad(string, bool) (string, error)
+
+	// FunctionList returns the libraries of functions.
+	//
+	// See: https://redis.io/commands/function-list
+	FunctionList(FunctionListOptions) ([]LibraryInfo, error)
+
+	// FunctionDelete deletes a library of functions.
+	//
+	// See: https://redis.io/commands/function-delete
+	FunctionDelete(string) error
+
+	// FunctionFlush deletes all the libraries of functions.
+	//
+	// See: https://redis.io/commands/function-flush
+	FunctionFlush() error
+
+	// FunctionDump returns a serialized payload of the libraries.
+	//
+	// See: https://redis.io/commands/function-dump
+	FunctionDump() ([]byte, error)
+
+	// FunctionRestore restores the libraries of a payload from FunctionDump.
+	//
+	// See: https://redis.io/commands/function-restore
+	FunctionRestore([]byte, string) error
+
+	// FCall calls a function, returning its reply.
+	//
+	// See: https://redis.io/commands/fcall
+	FCall(string, []string, ...interface{}) (interface{}, error)
+
+	// FCallRO calls a read only function, returning its reply. It's sent to
+	// the configured server, as there's no routing of reads to replicas.
+	//
+	// See: https://redis.io/commands/fcall_ro
+	FCallRO(string, []string, ...interface{}) (interface{}, error)
+
+	//
+	// Streams Commands
+	//
+
+	// XAdd appends an entry to a stream, returning its ID.
+	//
+	// See: https://redis.io/commands/xadd
+	XAdd(string, map[string]string, XAddOptions) (string, error)
+
+	// XRange returns the entries of a stream between two IDs.
+	//
+	// See: https://redis.io/commands/xrange
+	XRange(string, string, string, int) ([]StreamEntry, error)
+
+	// XRevRange returns the entries of a stream between two IDs, in reverse.
+	//
+	// See: https://redis.io/commands/xrevrange
+	XRevRange(string, string, string, int) ([]StreamEntry, error)
+
+	// XRead returns the entries of streams after the given IDs, optionally
+	// blocking until there are some.
+	//
+	// See: https://redis.io/commands/xread
+	XRead(map[string]string, XReadOptions) (map[string][]StreamEntry, error)
+
+	// XTrim trims a stream, returning the number of entries deleted.
+	//
+	// See: https://redis.io/commands/xtrim
+	XTrim(string, XTrimOptions) (int64, error)
+
+	// XLen returns the number of entries in a stream.
+	//
+	// See: https://redis.io/commands/xlen
+	XLen(string) (int64, error)
+
+	// XDel deletes entries from a stream, returning the number deleted.
+	//
+	// See: https://redis.io/commands/xdel
+	XDel(string, ...string) (int64, error)
+
+	// XInfoStream returns information about a stream.
+	//
+	// See: https://redis.io/commands/xinfo-stream
+	XInfoStream(string) (StreamInfo, error)
+
+	// XInfoGroups returns information about the consumer groups of a stream.
+	//
+	// See: https://redis.io/commands/xinfo-groups
+	XInfoGroups(string) ([]StreamGroupInfo, error)
+
+	// XGroupCreate creates a consumer group of a stream.
+	//
+	// See: https://redis.io/commands/xgroup-create
+	XGroupCreate(string, string, string, bool) error
+
+	// XReadGroup returns the entries of streams for a consumer of a group,
+	// optionally blocking until there are some.
+	//
+	// See: https://redis.io/commands/xreadgroup
+	XReadGroup(string, string, map[string]string, XReadGroupOptions) (map[string][]StreamEntry, error)
+
+	// XAck acknowledges pending entries of a group.
+	//
+	// See: https://redis.io/commands/xack
+	XAck(string, string, ...string) (int64, error)
+
+	// XPending returns a summary of the pending entries of a group.
+	//
+	// See: https://redis.io/commands/xpending
+	XPending(string, string) (PendingSummary, error)
+
+	// XPendingExt returns the pending entries of a group.
+	//
+	// See: https://redis.io/commands/xpending
+	XPendingExt(string, string, XPendingOptions) ([]PendingEntry, error)
+
+	// XClaim claims idle pending entries of a group for a consumer.
+	//
+	// See: https://redis.io/commands/xclaim
+	XClaim(string, string, string, time.Duration, ...string) ([]StreamEntry, error)
+
+	// XAutoClaim claims the idle pending entries of a group for a consumer,
+	// returning the ID to continue from.
+	//
+	// See: https://redis.io/commands/xautoclaim
+	XAutoClaim(string, string, string, time.Duration, string, int) (string, []StreamEntry, error)
+
+	// NewConsumer returns a Consumer, which processes the entries of a stream
+	// as a consumer of a group once Run.
+	NewConsumer(ConsumerOptions) (*Consumer, error)
+
 	// Strings
 	Append(string, string) (int64, error)
 	Get(string) (string, error)
+	GetBytes(string, []byte) ([]byte, error)
 	Incr(string) (int64, error)
 	MGet(...string) ([]string, error)
+	MGetInto([]string, ...string) ([]string, error)
 	Set(string, string) error
 	SetEx(string, string, uint) error
 
 	// Close
 	Close() error
 
+	// Shutdown stops new commands, waits for those in flight, then closes
+	Shutdown(context.Context) error
+
+	// Stats returns the pool, command, retry and circuit breaker statistics
+	Stats() Stats
+
 	// Transaction
 
 	// Multi is our entry into Transaction
@@ -137,6 +414,10 @@ type Wredis interface {
 	String(stringFunc) (string, error)
 	Strings(stringsFunc) ([]string, error)
 
+	// Do sends any command to Redis, returning the raw reply. Like every other
+	// command, it's denied with ErrDenied if the Policy doesn't allow it.
+	Do(string, ...interface{}) (interface{}, error)
+
 	// Convenience funcions
 
 	// Appends calls a s
@@ -1,8 +1,14 @@
 package wredis_test
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	. "github.com/crowdriff/wredis"
 
+	"github.com/garyburd/redigo/redis"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -36,4 +42,96 @@ var _ = Describe("impl", func() {
 		Ω(pool).ShouldNot(BeNil())
 		Ω(pool.FlushAll()).Should(Succeed())
 	})
+	Context("Warmup", func() {
+		It("should dial the idle connections when created", func() {
+			pool, err = Safe(Warmup(2))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.Stats().Stats.IdleCount).Should(Equal(2))
+		})
+
+		It("should fail when no connections can be dialed", func() {
+			_, err = Safe(Port(1025), Warmup(2))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("connection refused"))
+		})
+
+		It("should fail given more connections than MaxIdle", func() {
+			_, err = Safe(Warmup(4), MaxIdle(3))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: min idle exceeds max idle"))
+
+			_, err = Safe(Warmup(-1))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(Equal("wredis: invalid warmup"))
+		})
+	})
+
+	Context("Shutdown", func() {
+		var (
+			started chan struct{}
+			release chan struct{}
+			done    chan error
+		)
+
+		// inflight runs a command, which waits to be released before returning
+		// its connection to the pool
+		inflight := func() {
+			_, err := pool.Int(func(conn redis.Conn) (int, error) {
+				_, err := conn.Do("PING")
+				close(started)
+				<-release
+				return 0, err
+			})
+			done <- err
+		}
+
+		BeforeEach(func() {
+			started = make(chan struct{})
+			release = make(chan struct{})
+			done = make(chan error, 1)
+
+			pool, err = Safe()
+			Ω(err).ShouldNot(HaveOccurred())
+			go inflight()
+			<-started
+		})
+
+		It("should wait for commands in flight", func() {
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- pool.Shutdown(context.Background())
+			}()
+
+			// new commands fail, while waiting for the command in flight
+			Eventually(func() bool {
+				_, err := pool.Ping()
+				return errors.Is(err, ErrClosed)
+			}).Should(BeTrue())
+			_, err = pool.Exists("a")
+			Ω(errors.Is(err, ErrClosed)).Should(BeTrue())
+			_, err = pool.Del("a")
+			Ω(errors.Is(err, ErrClosed)).Should(BeTrue())
+			Ω(errors.Is(pool.Rename("a", "b"), ErrClosed)).Should(BeTrue())
+			_, err = pool.Keys("*")
+			Ω(errors.Is(err, ErrClosed)).Should(BeTrue())
+			_, err = pool.LPush("a", "1")
+			Ω(errors.Is(err, ErrClosed)).Should(BeTrue())
+			Consistently(shutdown, 50*time.Millisecond).ShouldNot(Receive())
+
+			close(release)
+			Eventually(done).Should(Receive(BeNil()))
+			Eventually(shutdown).Should(Receive(BeNil()))
+			pool = nil
+		})
+
+		It("should close once the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			Ω(pool.Shutdown(ctx)).Should(Equal(context.DeadlineExceeded))
+			close(release)
+			Eventually(done).Should(Receive())
+			pool = nil
+		})
+	})
 })